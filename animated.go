@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// animatedExt is the extension of the animated previews of --animated.
+const animatedExt = ".gif"
+
+// animatedName returns the file name of the animated preview of the image
+// path.
+func animatedName(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + animatedExt
+}
+
+// genAnimated writes the frames of src, if it is an animated GIF, to path
+// as an animated GIF, keeping the frame delays. Every frame is composed
+// like the image of v: on the canvas, in the box, with the border and
+// effects. It returns false if src is not animated.
+func genAnimated(opts *Options, v *Variant, src, console, game, path string) (bool, error) {
+	if !strings.EqualFold(filepath.Ext(src), ".gif") {
+		return false, nil
+	}
+	f, err := os.Open(src)
+	if err != nil {
+		return false, err
+	}
+	g, err := gif.DecodeAll(f)
+	f.Close()
+	if err != nil {
+		return false, err
+	}
+	if len(g.Image) < 2 {
+		return false, nil
+	}
+
+	p := opts.Palette
+	if p == nil {
+		p = palette.WebSafe
+	}
+	out := &gif.GIF{LoopCount: g.LoopCount}
+	for i, frame := range gifFrames(g) {
+		img, _ := drawArtwork(opts, v, frame)
+		decorated, err := decorateImage(opts, img, console, game)
+		if err != nil {
+			return false, err
+		}
+		out.Image = append(out.Image, quantize(finishImage(opts, decorated), p, false, true))
+		delay := 0
+		if i < len(g.Delay) {
+			delay = g.Delay[i]
+		}
+		out.Delay = append(out.Delay, delay)
+		// Every frame is complete, so it replaces the previous one.
+		out.Disposal = append(out.Disposal, gif.DisposalBackground)
+	}
+	// Trimmed frames differ in their bounds. Like the image, the animation
+	// starts at the top left corner of what is left.
+	var bounds image.Rectangle
+	for _, frame := range out.Image {
+		bounds = bounds.Union(frame.Rect)
+	}
+	for _, frame := range out.Image {
+		frame.Rect = frame.Rect.Sub(bounds.Min)
+	}
+	out.Config.Width, out.Config.Height = bounds.Dx(), bounds.Dy()
+	encode := func(w io.Writer, _ image.Image) error {
+		return gif.EncodeAll(w, out)
+	}
+	return true, opts.writeImage(path, nil, encode)
+}
+
+// gifFrames returns the frames of g as they are shown, with each frame
+// drawn over what the previous ones left according to their disposal
+// methods.
+func gifFrames(g *gif.GIF) []*image.RGBA {
+	screen := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if screen.Empty() {
+		for _, frame := range g.Image {
+			screen = screen.Union(frame.Bounds())
+		}
+	}
+	canvas := image.NewRGBA(screen)
+	var frames []*image.RGBA
+	for i, frame := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = cloneRGBA(canvas)
+		}
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		frames = append(frames, cloneRGBA(canvas))
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return frames
+}
+
+func cloneRGBA(img *image.RGBA) *image.RGBA {
+	dst := image.NewRGBA(img.Rect)
+	copy(dst.Pix, img.Pix)
+	return dst
+}
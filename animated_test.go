@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenAnimatedComposesFrames(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "game.gif")
+	g := &gif.GIF{}
+	for i, c := range []color.Color{color.RGBA{0xff, 0, 0, 0xff}, color.RGBA{0, 0, 0xff, 0xff}} {
+		frame := image.NewPaletted(image.Rect(0, 0, 20, 10), palette.WebSafe)
+		for j := range frame.Pix {
+			frame.Pix[j] = uint8(frame.Palette.Index(c))
+		}
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 10*(i+1))
+	}
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gif.EncodeAll(f, g); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	opts := &Options{CanvasW: 100, CanvasH: 80, BgColor: color.White, BorderWidth: 2, BorderColor: color.Black}
+	v := &Variant{Layout: LayoutOpts{BoxX: 10, BoxY: 20, BoxW: 40, BoxH: 40}}
+	path := filepath.Join(dir, "out.gif")
+	ok, err := genAnimated(opts, v, src, "gb", "game", path)
+	if !ok || err != nil {
+		t.Fatalf("genAnimated = %v, %v; want true, nil", ok, err)
+	}
+	f, err = os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	out, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Image) != 2 || out.Delay[0] != 10 || out.Delay[1] != 20 {
+		t.Fatalf("got %d frames with delays %v, want 2 with [10 20]", len(out.Image), out.Delay)
+	}
+	// The 20x10 frames are scaled to 40x20 and centered in the box, at
+	// y 30 to 50, with a border around them.
+	for i, frame := range out.Image {
+		if b := frame.Bounds(); b.Dx() != 100 || b.Dy() != 80 {
+			t.Errorf("frame %d is %dx%d, want the canvas size 100x80", i, b.Dx(), b.Dy())
+		}
+		for _, p := range []struct {
+			x, y int
+			want color.Color
+		}{
+			{5, 5, color.White},
+			{30, 40, g.Image[i].At(0, 0)},
+			{30, 29, color.Black},
+		} {
+			r, gr, b, _ := frame.At(p.x, p.y).RGBA()
+			wr, wg, wb, _ := p.want.RGBA()
+			if r>>8 != wr>>8 || gr>>8 != wg>>8 || b>>8 != wb>>8 {
+				t.Errorf("frame %d at %d,%d is %v, want %v", i, p.x, p.y, frame.At(p.x, p.y), p.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,243 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// titlesArchives are the names the MAME Extras titles archive may have, in
+// order of preference.
+var titlesArchives = []string{"titles.zip", "titles.tar", "titles.tar.gz", "titles.tgz"}
+
+// artArchive is an archive of artwork files, indexed by their names without
+// directory and extension.
+type artArchive struct {
+	path    string
+	gzipped bool
+
+	zip      *zip.ReadCloser
+	zipFiles map[string]*zip.File
+
+	// tarMembers maps names to the offset and size of their data in
+	// tarFile. For a gzipped archive, tarFile is a temporary copy of the
+	// unpacked tar file.
+	tarFile    *os.File
+	tarMembers map[string][2]int64
+	// tempPath is the path of tarFile if it still has to be removed.
+	tempPath string
+}
+
+var archiveCache = struct {
+	sync.Mutex
+	m map[string]*artArchive
+}{m: make(map[string]*artArchive)}
+
+// memberName returns the key an archive member is indexed by.
+func memberName(name string) string {
+	return trimExt(path.Base(name))
+}
+
+// openArtArchive returns the indexed archive at p. Archives are opened
+// once and stay open.
+func openArtArchive(p string) (*artArchive, error) {
+	archiveCache.Lock()
+	defer archiveCache.Unlock()
+	if a, ok := archiveCache.m[p]; ok {
+		return a, nil
+	}
+	a := &artArchive{path: p}
+	var err error
+	lower := strings.ToLower(p)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		err = a.indexZip()
+	case strings.HasSuffix(lower, ".tar"):
+		err = a.indexTar()
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		a.gzipped = true
+		err = a.indexTar()
+	default:
+		err = fmt.Errorf("Unsupported archive type: %s", filepath.Base(p))
+	}
+	if err != nil {
+		return nil, err
+	}
+	archiveCache.m[p] = a
+	return a, nil
+}
+
+func (a *artArchive) indexZip() error {
+	r, err := zip.OpenReader(a.path)
+	if err != nil {
+		return err
+	}
+	a.zip = r
+	a.zipFiles = make(map[string]*zip.File)
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		// Like a search through the archive, the first of several members
+		// of the same name wins.
+		if n := memberName(f.Name); a.zipFiles[n] == nil {
+			a.zipFiles[n] = f
+		}
+	}
+	return nil
+}
+
+// unpack copies the tar stream of the gzipped file f to a temporary file,
+// so members can be read from it directly. It closes f.
+func (a *artArchive) unpack(f *os.File) (*os.File, error) {
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp("", "artgen-*.tar")
+	if err != nil {
+		return nil, err
+	}
+	// Where files can be removed while they are open, the copy is gone as
+	// soon as it is closed, even if we crash. Elsewhere, closeArtArchives
+	// removes it.
+	if err := os.Remove(tmp.Name()); err != nil {
+		a.tempPath = tmp.Name()
+	}
+	if _, err = io.Copy(tmp, gz); err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tmp.Close()
+		a.close()
+		return nil, err
+	}
+	return tmp, nil
+}
+
+func (a *artArchive) indexTar() error {
+	f, err := os.Open(a.path)
+	if err != nil {
+		return err
+	}
+	if a.gzipped {
+		if f, err = a.unpack(f); err != nil {
+			return err
+		}
+	}
+	a.tarFile = f
+	a.tarMembers = make(map[string][2]int64)
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			a.close()
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		// The reader is positioned at the start of the member's data.
+		offset, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			a.close()
+			return err
+		}
+		if _, ok := a.tarMembers[memberName(hdr.Name)]; !ok {
+			a.tarMembers[memberName(hdr.Name)] = [2]int64{offset, hdr.Size}
+		}
+	}
+	return nil
+}
+
+// close closes the archive and removes its temporary files.
+func (a *artArchive) close() {
+	if a.zip != nil {
+		a.zip.Close()
+	}
+	if a.tarFile != nil {
+		a.tarFile.Close()
+	}
+	if len(a.tempPath) > 0 {
+		os.Remove(a.tempPath)
+	}
+}
+
+// closeArtArchives closes all archives opened by openArtArchive.
+func closeArtArchives() {
+	archiveCache.Lock()
+	defer archiveCache.Unlock()
+	for p, a := range archiveCache.m {
+		a.close()
+		delete(archiveCache.m, p)
+	}
+}
+
+// has reports whether the archive contains artwork for game.
+func (a *artArchive) has(game string) bool {
+	if a.zip != nil {
+		_, ok := a.zipFiles[game]
+		return ok
+	}
+	_, ok := a.tarMembers[game]
+	return ok
+}
+
+// load decodes the artwork for game. It returns errNoArtwork if the archive
+// has none.
+func (a *artArchive) load(game string) (image.Image, error) {
+	r, err := a.open(game)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	img, _, err := image.Decode(r)
+	return img, err
+}
+
+// open returns a reader for the artwork file of game. It returns
+// errNoArtwork if the archive has none.
+func (a *artArchive) open(game string) (io.ReadCloser, error) {
+	if a.zip != nil {
+		f, ok := a.zipFiles[game]
+		if !ok {
+			return nil, errNoArtwork
+		}
+		return f.Open()
+	}
+
+	m, ok := a.tarMembers[game]
+	if !ok {
+		return nil, errNoArtwork
+	}
+	return io.NopCloser(io.NewSectionReader(a.tarFile, m[0], m[1])), nil
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTar writes a tar file with a PNG named after each game, 1 pixel
+// high and as wide as its position in games.
+func writeTar(t *testing.T, p string, gzipped bool, games ...string) {
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var w io.Writer = f
+	if gzipped {
+		gz := gzip.NewWriter(f)
+		defer gz.Close()
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	defer tw.Close()
+	for i, game := range games {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, i+1, 1))); err != nil {
+			t.Fatal(err)
+		}
+		hdr := &tar.Header{Name: "titles/" + game + ".png", Mode: 0644, Size: int64(buf.Len()), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(buf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTarArchives(t *testing.T) {
+	dir := t.TempDir()
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	defer func() {
+		closeArtArchives()
+		if left, _ := filepath.Glob(filepath.Join(tmp, "*")); len(left) > 0 {
+			t.Errorf("temporary files left behind: %v", left)
+		}
+	}()
+	for _, name := range []string{"titles.tar", "titles.tar.gz"} {
+		p := filepath.Join(dir, name)
+		writeTar(t, p, name != "titles.tar", "pacman", "galaga")
+		a, err := openArtArchive(p)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		// Look up each member more than once, and out of order.
+		for _, game := range []string{"galaga", "pacman", "galaga"} {
+			if !a.has(game) {
+				t.Errorf("%s: has(%q) = false", name, game)
+			}
+			img, err := a.load(game)
+			if err != nil {
+				t.Errorf("%s: load(%q): %s", name, game, err)
+				continue
+			}
+			want := 1
+			if game == "galaga" {
+				want = 2
+			}
+			if got := img.Bounds().Dx(); got != want {
+				t.Errorf("%s: load(%q) is %d wide, want %d", name, game, got, want)
+			}
+		}
+		if a.has("dkong") {
+			t.Errorf("%s: has(\"dkong\") = true", name)
+		}
+		if _, err := a.load("dkong"); !errors.Is(err, errNoArtwork) {
+			t.Errorf("%s: load(\"dkong\") = %v, want errNoArtwork", name, err)
+		}
+	}
+}
+
+func TestArchiveResolverTriesAllArchives(t *testing.T) {
+	dir := t.TempDir()
+	writeTar(t, filepath.Join(dir, "titles.tar"), false, "pacman")
+	writeTar(t, filepath.Join(dir, "titles.tgz"), true, "pacman", "galaga")
+	r := ArchiveResolver{dir}
+	for game, want := range map[string]string{"pacman": "titles.tar", "galaga": "titles.tgz"} {
+		rc, err := r.Resolve("arcade", game)
+		if err != nil {
+			t.Errorf("Resolve(%q): %s", game, err)
+			continue
+		}
+		rc.Close()
+		if got := filepath.Base(rc.(namedReadCloser).Name()); got != want {
+			t.Errorf("Resolve(%q) read from %s, want %s", game, got, want)
+		}
+	}
+	if _, err := r.Resolve("arcade", "dkong"); !errors.Is(err, errNoArtwork) {
+		t.Errorf("Resolve(\"dkong\") = %v, want errNoArtwork", err)
+	}
+}
+
+func TestArchivesPreferFirstMember(t *testing.T) {
+	dir := t.TempDir()
+	// The first pacman is 1 pixel wide, the second one 2.
+	zp := filepath.Join(dir, "titles.zip")
+	f, err := os.Create(zp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for i, name := range []string{"a/pacman.png", "b/pacman.png"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := png.Encode(w, image.NewRGBA(image.Rect(0, 0, i+1, 1))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	tp := filepath.Join(dir, "titles.tar")
+	writeTar(t, tp, false, "pacman", "pacman")
+
+	for _, p := range []string{zp, tp} {
+		a, err := openArtArchive(p)
+		if err != nil {
+			t.Fatalf("%s: %s", p, err)
+		}
+		img, err := a.load("pacman")
+		if err != nil {
+			t.Fatalf("%s: %s", p, err)
+		}
+		if w := img.Bounds().Dx(); w != 1 {
+			t.Errorf("%s: loaded the pacman that is %d wide, want the first one", filepath.Base(p), w)
+		}
+	}
+}
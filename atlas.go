@@ -0,0 +1,225 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"path/filepath"
+
+	"golang.org/x/image/draw"
+)
+
+// atlasPadding is the number of transparent pixels between images on an
+// atlas sheet, so that filtering when rendering doesn't bleed neighbors in.
+const atlasPadding = 1
+
+// atlasEntry is where a game's artwork is on an atlas sheet.
+type atlasEntry struct {
+	Atlas string `json:"atlas"`
+	X     int    `json:"x"`
+	Y     int    `json:"y"`
+	W     int    `json:"w"`
+	H     int    `json:"h"`
+}
+
+// atlasFileName returns the name of the JSON file describing the atlas of
+// console, relative to the console's output directory.
+func atlasFileName(console string) string {
+	return console + "_atlas.json"
+}
+
+// isPowerOfTwo reports whether n is a positive power of two.
+func isPowerOfTwo(n int) bool {
+	return n > 0 && n&(n-1) == 0
+}
+
+// nextPowerOfTwo returns the smallest power of two that is at least n.
+func nextPowerOfTwo(n int) int {
+	p := 1
+	for p < n {
+		p *= 2
+	}
+	return p
+}
+
+// atlasPacker packs images into square sheets of at most max x max pixels
+// using a simple shelf packer: images are placed left to right, starting a
+// new shelf below when a row is full, and a new sheet when a sheet is full.
+// Full sheets are written right away, cropped to the smallest power of two
+// size holding their images.
+type atlasPacker struct {
+	opts      *Options
+	dir       string
+	console   string
+	max       int
+	entries   map[string]atlasEntry
+	sheet     draw.RGBA64Image
+	n         int
+	x, y      int
+	shelfH    int
+	usedW     int
+	usedH     int
+	games     []string
+	sources   []string
+	numFailed int
+}
+
+func (p *atlasPacker) sheetName() string {
+	return fmt.Sprintf("%s_atlas%d%s", p.console, p.n, p.opts.Format.Ext)
+}
+
+// add places the image of a game on the current sheet.
+func (p *atlasPacker) add(game string, img image.Image, src string) error {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if p.x > 0 && p.x+w > p.max {
+		p.x, p.y = 0, p.y+p.shelfH+atlasPadding
+		p.shelfH = 0
+	}
+	if p.sheet != nil && p.y+h > p.max {
+		if err := p.flush(); err != nil {
+			return err
+		}
+	}
+	if p.sheet == nil {
+		p.sheet = p.opts.newImage(image.Rect(0, 0, p.max, p.max))
+	}
+	draw.Draw(p.sheet, image.Rect(p.x, p.y, p.x+w, p.y+h), img, b.Min, draw.Src)
+	p.entries[game] = atlasEntry{Atlas: p.sheetName(), X: p.x, Y: p.y, W: w, H: h}
+	p.games = append(p.games, game)
+	if len(src) > 0 {
+		p.sources = append(p.sources, src)
+	}
+	p.usedW = maxInt(p.usedW, p.x+w)
+	p.usedH = maxInt(p.usedH, p.y+h)
+	p.shelfH = maxInt(p.shelfH, h)
+	p.x += w + atlasPadding
+	return nil
+}
+
+// flush writes the current sheet, if there is one, and starts a new one.
+func (p *atlasPacker) flush() error {
+	if p.sheet == nil {
+		return nil
+	}
+	sheet := subImage(p.sheet, image.Rect(0, 0, nextPowerOfTwo(p.usedW), nextPowerOfTwo(p.usedH)))
+	img := finishImage(p.opts, sheet)
+	name := p.sheetName()
+	targetName := filepath.Join(p.dir, name)
+	name = trimExt(name)
+	games := p.games
+	p.sheet, p.x, p.y, p.shelfH, p.usedW, p.usedH = nil, 0, 0, 0, 0, 0
+	p.games, p.n = nil, p.n+1
+	sources := p.sources
+	p.sources = nil
+
+	fail := func(err error) error {
+		for _, game := range games {
+			delete(p.entries, game)
+		}
+		p.opts.report(p.console, name, StatusFailed, err)
+		p.numFailed++
+		return err
+	}
+	if err := p.opts.writeImage(targetName, img, p.opts.imageEncoder(sources)); err != nil {
+		return fail(err)
+	}
+	if err := markManaged(p.dir); err != nil {
+		logger.Printf("Can't mark %s as output directory: %s\n", p.dir, err)
+	}
+	if p.opts.PostCmd != nil {
+		if err := runPostCmd(p.opts.PostCmd, targetName); err != nil {
+			logger.Printf("Post-processing %s failed: %s\n", targetName, err)
+		}
+	}
+	p.opts.report(p.console, name, StatusCreated, nil)
+	return nil
+}
+
+// genAtlas packs the artwork of all games in ROM folder folder, scaled to
+// fit the box of the first variant, into atlas sheets and writes a JSON file
+// with the position of every game.
+func genAtlas(opts *Options, folder string) (int, error) {
+	romDir := filepath.Join(opts.RomDir, folder)
+	console := opts.consoleName(folder)
+	opts = opts.forConsole(console)
+	targetDir := outputDir(opts, console)
+
+	files, err := romFiles(opts, romDir, console)
+	if err != nil {
+		return 0, err
+	}
+	if len(files) == 0 {
+		logger.Printf("%s: no ROMs found in %s\n", console, romDir)
+		return 0, nil
+	}
+	if opts.Clean {
+		cleanConsoleDir(targetDir, romDir, console)
+	}
+	if _, err := mkdirAll(targetDir); err != nil {
+		return 0, fmt.Errorf("Can't create output directory: %w", err)
+	}
+
+	p := &atlasPacker{
+		opts:    opts,
+		dir:     targetDir,
+		console: console,
+		max:     opts.AtlasMax,
+		entries: make(map[string]atlasEntry),
+	}
+	v := &opts.Variants[0]
+	mediaDir := v.consoleMediaDir(console, opts.Aliases)
+	box := LayoutOpts{BoxW: v.Layout.BoxW, BoxH: v.Layout.BoxH}
+	failed := 0
+	for _, filename := range files {
+		game := trimExt(filename)
+		if opts.Games != nil && !opts.Games.match(filename, game) {
+			continue
+		}
+		artwork, src, err := loadGameArtwork(opts, mediaDir, console, game, box.BoxW, box.BoxH)
+		if err != nil && errors.Is(err, errNoArtwork) && opts.NoArtOK.match(filename, game) {
+			continue
+		}
+		if err != nil {
+			opts.report(console, game, StatusFailed, err)
+			failed++
+			continue
+		}
+		b := artwork.Bounds()
+		w, h, _, _ := opts.fitLayout(b.Dx(), b.Dy(), box)
+		scaled := scaleImage(opts, opts.shrinkSource(artwork, w, h), w, h, opts.scalerFor(b.Dx(), b.Dy(), w, h))
+		if err := p.add(game, scaled, src); errors.Is(err, errBudgetExceeded) {
+			return failed + p.numFailed, err
+		}
+	}
+	if err := p.flush(); errors.Is(err, errBudgetExceeded) {
+		return failed + p.numFailed, err
+	}
+	failed += p.numFailed
+
+	if len(p.entries) > 0 || opts.KeepEmpty {
+		name := filepath.Join(targetDir, atlasFileName(console))
+		if err := writeJSONFile(opts.Budget, name, p.entries); err != nil {
+			logger.Printf("Can't write atlas index %s: %s\n", name, err)
+			failed++
+		}
+	}
+	return failed, nil
+}
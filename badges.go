@@ -0,0 +1,193 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/vector"
+)
+
+// badgeInfo is what the badges of a game show.
+type badgeInfo struct {
+	Favorite bool
+	Plays    int
+}
+
+// badgeIndex maps "console/game" and plain game names to their badges.
+type badgeIndex map[string]badgeInfo
+
+var (
+	starColor       = color.RGBA{0xff, 0xcc, 0x00, 0xff}
+	countBadgeColor = color.RGBA{0x00, 0x00, 0x00, 0xc0}
+)
+
+// badgeCorners are the corners badges can be drawn in.
+var badgeCorners = map[string]bool{
+	"top_left":     true,
+	"top_right":    true,
+	"bottom_left":  true,
+	"bottom_right": true,
+}
+
+// loadBadges reads a CSV file with a header line naming its columns: game
+// is required, console, favorite (1, true, or yes), and plays are optional.
+func loadBadges(path string) (badgeIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return badgeIndex{}, nil
+	}
+	cols := make(map[string]int)
+	for i, name := range records[0] {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	gameCol, ok := cols["game"]
+	if !ok {
+		return nil, fmt.Errorf("no game column")
+	}
+	field := func(rec []string, name string) string {
+		if i, ok := cols[name]; ok {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+
+	idx := make(badgeIndex)
+	for n, rec := range records[1:] {
+		var b badgeInfo
+		switch strings.ToLower(field(rec, "favorite")) {
+		case "1", "true", "yes":
+			b.Favorite = true
+		}
+		if plays := field(rec, "plays"); len(plays) > 0 {
+			if b.Plays, err = strconv.Atoi(plays); err != nil {
+				return nil, fmt.Errorf("line %d: invalid plays %q", n+2, plays)
+			}
+		}
+		key := strings.TrimSpace(rec[gameCol])
+		if console := field(rec, "console"); len(console) > 0 {
+			key = console + "/" + key
+		}
+		idx[key] = b
+	}
+	return idx, nil
+}
+
+// lookup returns the badges of a game, preferring entries for its console.
+func (idx badgeIndex) lookup(console, game string) (badgeInfo, bool) {
+	if b, ok := idx[console+"/"+game]; ok {
+		return b, true
+	}
+	b, ok := idx[game]
+	return b, ok
+}
+
+// drawBadges draws a star for favorites and the play count, if any, in the
+// given corner of dst.
+func drawBadges(dst draw.Image, b badgeInfo, corner string) error {
+	bounds := dst.Bounds()
+	size := maxInt(16, bounds.Dy()/12)
+	margin := size / 4
+	var badges []func(image.Rectangle) error
+	if b.Favorite {
+		badges = append(badges, func(r image.Rectangle) error {
+			drawStar(dst, r)
+			return nil
+		})
+	}
+	if b.Plays > 0 {
+		badges = append(badges, func(r image.Rectangle) error {
+			drawCircle(dst, r, countBadgeColor)
+			return drawText(dst, r, strconv.Itoa(b.Plays), float64(size)*0.45, color.White)
+		})
+	}
+
+	// Badges are lined up from the corner towards the center.
+	x, dx := bounds.Min.X+margin, size+margin
+	if strings.HasSuffix(corner, "right") {
+		x, dx = bounds.Max.X-margin-size, -dx
+	}
+	y := bounds.Min.Y + margin
+	if strings.HasPrefix(corner, "bottom") {
+		y = bounds.Max.Y - margin - size
+	}
+	for _, drawBadge := range badges {
+		if err := drawBadge(image.Rect(x, y, x+size, y+size)); err != nil {
+			return err
+		}
+		x += dx
+	}
+	return nil
+}
+
+// drawStar draws a five-pointed star filling r.
+func drawStar(dst draw.Image, r image.Rectangle) {
+	z := vector.NewRasterizer(r.Dx(), r.Dy())
+	cx, cy := float64(r.Dx())/2, float64(r.Dy())/2
+	outer := math.Min(cx, cy)
+	inner := outer * 0.4
+	for i := 0; i < 10; i++ {
+		rad := outer
+		if i%2 == 1 {
+			rad = inner
+		}
+		a := -math.Pi/2 + float64(i)*math.Pi/5
+		px, py := float32(cx+rad*math.Cos(a)), float32(cy+rad*math.Sin(a))
+		if i == 0 {
+			z.MoveTo(px, py)
+		} else {
+			z.LineTo(px, py)
+		}
+	}
+	z.ClosePath()
+	z.Draw(dst, r, image.NewUniform(starColor), image.Point{})
+}
+
+// drawCircle draws a filled circle inscribed in r.
+func drawCircle(dst draw.Image, r image.Rectangle, c color.Color) {
+	z := vector.NewRasterizer(r.Dx(), r.Dy())
+	cx, cy := float64(r.Dx())/2, float64(r.Dy())/2
+	rad := math.Min(cx, cy)
+	const segments = 48
+	z.MoveTo(float32(cx+rad), float32(cy))
+	for i := 1; i < segments; i++ {
+		a := float64(i) * 2 * math.Pi / segments
+		z.LineTo(float32(cx+rad*math.Cos(a)), float32(cy+rad*math.Sin(a)))
+	}
+	z.ClosePath()
+	z.Draw(dst, r, image.NewUniform(c), image.Point{})
+}
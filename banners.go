@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math/rand"
+	"path/filepath"
+	"strings"
+)
+
+// bannerLogoSize is the fraction of the banner the system logo may span.
+const bannerLogoSize = 0.6
+
+// bannerCandidates returns the games to try as the representative game of
+// console, in the order they should be tried.
+func bannerCandidates(opts *Options, console string, games []string) []string {
+	if game, ok := opts.BannerGames[console]; ok {
+		return []string{game}
+	}
+	if opts.BannerPick == "random" {
+		games = append([]string(nil), games...)
+		rand.Shuffle(len(games), func(i, j int) { games[i], games[j] = games[j], games[i] })
+	}
+	return games
+}
+
+// loadSystemLogo returns the logo of console in dir and the file it was
+// loaded from, or nil if there is none.
+func loadSystemLogo(dir, console string) (image.Image, string, error) {
+	if len(dir) == 0 {
+		return nil, "", nil
+	}
+	logo, src, err := loadArtwork(dir, "", "", console)
+	if err == errNoArtwork {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("Can't load logo for %s: %w", console, err)
+	}
+	return logo, src, nil
+}
+
+// genSystemBanner writes a banner for the console in ROM folder folder to
+// SystemBanners: the artwork of a representative game with the system logo
+// on top, or the console's name if there is no logo.
+func genSystemBanner(opts *Options, folder string) error {
+	console := opts.consoleName(folder)
+	opts = opts.forConsole(console).withConsoleBackground(console)
+	files, err := romFiles(opts, filepath.Join(opts.RomDir, folder), console)
+	if err != nil {
+		return err
+	}
+	var games []string
+	for _, f := range files {
+		games = append(games, trimExt(f))
+	}
+	v := &opts.Variants[0]
+	mediaDir := v.consoleMediaDir(console, opts.Aliases)
+	var artwork image.Image
+	var game, src string
+	for _, g := range bannerCandidates(opts, console, games) {
+		if artwork, src, err = findGameArtwork(opts, mediaDir, console, g); err == nil {
+			game = g
+			break
+		}
+	}
+	if artwork == nil {
+		return fmt.Errorf("No artwork found for any game of %s", console)
+	}
+
+	img := newCanvas(opts)
+	placeArtwork(opts, img, artwork, centeredLayout(opts.CanvasW, opts.CanvasH, 1))
+	logoBox := centeredLayout(opts.CanvasW, opts.CanvasH, bannerLogoSize)
+	sources := []string{src}
+	logo, logoSrc, err := loadSystemLogo(opts.SystemLogos, console)
+	if err != nil {
+		return err
+	}
+	if logo != nil {
+		// Logos are drawn as they are, without feathering or reflections.
+		plain := *opts
+		plain.Feather, plain.Reflection = 0, 0
+		placeArtwork(&plain, img, logo, logoBox)
+		sources = append(sources, logoSrc)
+	} else if err := drawText(img, boxRect(logoBox), strings.ToUpper(console), 48, color.White); err != nil {
+		return err
+	}
+	if opts.Vignette > 0 {
+		applyVignette(img, opts.Vignette)
+	}
+
+	out := finishImage(opts, img)
+	if _, err := mkdirAll(opts.SystemBanners); err != nil {
+		return fmt.Errorf("Can't create output directory: %w", err)
+	}
+	targetName := filepath.Join(opts.SystemBanners, console+opts.Format.Ext)
+	if err := opts.writeImage(targetName, out, opts.imageEncoder(sources)); err != nil {
+		return err
+	}
+	if opts.PostCmd != nil {
+		if err := runPostCmd(opts.PostCmd, targetName); err != nil {
+			logger.Printf("Post-processing %s failed: %s\n", targetName, err)
+		}
+	}
+	logger.Printf("Created banner for %s from %s in %s\n", console, game, targetName)
+	return nil
+}
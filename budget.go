@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// errBudgetExceeded is returned once writing another image would exceed
+// the output budget.
+var errBudgetExceeded = errors.New("Output budget exceeded")
+
+// outputBudget limits the number of bytes written to the output directories.
+type outputBudget struct {
+	max  int64
+	used int64
+}
+
+// newOutputBudget returns a budget of max bytes, reduced to the free space
+// on the file system holding root if that is known and smaller.
+func newOutputBudget(max int64, root string) *outputBudget {
+	// The output directory may not exist yet.
+	for !fileExists(root) && filepath.Dir(root) != root {
+		root = filepath.Dir(root)
+	}
+	if free, ok := freeSpace(root); ok && free < max {
+		logger.Printf("Only %d bytes free in %s, limiting output to that\n", free, root)
+		max = free
+	}
+	return &outputBudget{max: max}
+}
+
+// write calls write to write size bytes to path if that stays within the
+// budget, accounting for any existing file that gets replaced. Only files
+// that are written count against the budget. A nil budget has no limit.
+func (b *outputBudget) write(path string, size int64, write func() error) error {
+	if b == nil {
+		return write()
+	}
+	if fi, err := os.Stat(path); err == nil {
+		size -= fi.Size()
+	}
+	if b.used+size > b.max {
+		return fmt.Errorf("%w: writing %s would exceed %d bytes", errBudgetExceeded, path, b.max)
+	}
+	if err := write(); err != nil {
+		return err
+	}
+	b.used += size
+	return nil
+}
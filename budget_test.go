@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOutputBudgetWrite(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.png")
+	if err := os.WriteFile(existing, make([]byte, 40), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b := &outputBudget{max: 100}
+	written := 0
+	write := func() error {
+		written++
+		return nil
+	}
+	failedWrite := errors.New("disk on fire")
+
+	tests := []struct {
+		name     string
+		path     string
+		size     int64
+		write    func() error
+		wantErr  error
+		wantUsed int64
+	}{
+		{"fits", filepath.Join(dir, "a.png"), 60, write, nil, 60},
+		// A failed write doesn't use up the budget.
+		{"write fails", filepath.Join(dir, "b.png"), 30, func() error { return failedWrite }, failedWrite, 60},
+		{"too big", filepath.Join(dir, "c.png"), 41, write, errBudgetExceeded, 60},
+		// Replacing the 40 byte file only takes what the new one adds.
+		{"replaces", existing, 80, write, nil, 100},
+		{"full", filepath.Join(dir, "d.png"), 1, write, errBudgetExceeded, 100},
+	}
+	for _, tt := range tests {
+		before := written
+		err := b.write(tt.path, tt.size, tt.write)
+		if !errors.Is(err, tt.wantErr) || tt.wantErr == nil && err != nil {
+			t.Errorf("%s: write = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if errors.Is(err, errBudgetExceeded) && written != before {
+			t.Errorf("%s: wrote the file despite exceeding the budget", tt.name)
+		}
+		if b.used != tt.wantUsed {
+			t.Errorf("%s: used %d bytes, want %d", tt.name, b.used, tt.wantUsed)
+		}
+	}
+}
+
+func TestManifestsCountAgainstBudget(t *testing.T) {
+	dir := t.TempDir()
+	sums := checksums{"a.png": "00ff"}
+	index := []indexEntry{{Game: "a", Image: "a.png"}}
+
+	b := &outputBudget{max: 10}
+	if err := sums.save(b, filepath.Join(dir, "checksums.txt")); !errors.Is(err, errBudgetExceeded) {
+		t.Errorf("saving checksums = %v, want errBudgetExceeded", err)
+	}
+	if err := writeIndex(b, filepath.Join(dir, "index.json"), index); !errors.Is(err, errBudgetExceeded) {
+		t.Errorf("writing index = %v, want errBudgetExceeded", err)
+	}
+	if left, _ := filepath.Glob(filepath.Join(dir, "*")); len(left) > 0 {
+		t.Errorf("wrote %v despite exceeding the budget", left)
+	}
+
+	b = &outputBudget{max: 1000}
+	if err := sums.save(b, filepath.Join(dir, "checksums.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeIndex(b, filepath.Join(dir, "index.json"), index); err != nil {
+		t.Fatal(err)
+	}
+	var size int64
+	for _, name := range []string{"checksums.txt", "index.json"} {
+		fi, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		size += fi.Size()
+	}
+	if b.used != size {
+		t.Errorf("used %d bytes, want the %d written", b.used, size)
+	}
+}
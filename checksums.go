@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// checksumsFileName is the name of the checksum manifest written to each
+// console's output directory.
+const checksumsFileName = "checksums.txt"
+
+// checksums maps file names, relative to the directory of the manifest, to
+// their SHA-256 sums.
+type checksums map[string]string
+
+// add hashes the file name in dir.
+func (c checksums) add(dir, name string) error {
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	c[filepath.ToSlash(name)] = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
+
+// save writes the manifest to path in the format of sha256sum, so it can
+// be checked with "sha256sum -c" from the manifest's directory, within
+// budget b.
+func (c checksums) save(b *outputBudget, path string) error {
+	names := make([]string, 0, len(c))
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s  %s\n", c[name], name)
+	}
+	return b.write(path, int64(buf.Len()), func() error {
+		return ioutil.WriteFile(path, []byte(buf.String()), 0644)
+	})
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// managedMarker is the file that marks a directory as holding images
+// written by rg35xx-artgen. --clean only touches marked directories.
+const managedMarker = ".artgen"
+
+// markManaged marks dir as an output directory of rg35xx-artgen.
+func markManaged(dir string) error {
+	path := filepath.Join(dir, managedMarker)
+	if fileExists(path) {
+		return nil
+	}
+	return ioutil.WriteFile(path, nil, 0644)
+}
+
+// isCleanable reports whether --clean may remove the file filename from a
+// console's output directory: images in any of the supported formats, and
+// the index and checksum files written for console.
+func isCleanable(filename, console string) bool {
+	if filename == indexFileName(console) || filename == atlasFileName(console) || filename == checksumsFileName {
+		return true
+	}
+	return isImageFile(filename)
+}
+
+// cleanOutputDir removes all images and index files from dir, which must
+// be marked as managed. Other files and subdirectories are left alone. It
+// returns the number of files removed.
+func cleanOutputDir(dir, console string) (int, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !fileExists(filepath.Join(dir, managedMarker)) {
+		return 0, fmt.Errorf("no %s marker, so it was not written by rg35xx-artgen", managedMarker)
+	}
+	removed := 0
+	for _, f := range files {
+		if f.IsDir() || !f.Mode().IsRegular() || !isCleanable(f.Name(), console) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, f.Name())); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// shardDirs returns dir and the shard directories of --shard_by_letter in
+// it that are marked as managed, whether or not sharding is enabled, so
+// that images of previous runs are found either way.
+func shardDirs(dir string) []string {
+	dirs := []string{dir}
+	files, _ := ioutil.ReadDir(dir)
+	for _, f := range files {
+		if f.IsDir() && isShard(f.Name()) && fileExists(filepath.Join(dir, f.Name(), managedMarker)) {
+			dirs = append(dirs, filepath.Join(dir, f.Name()))
+		}
+	}
+	return dirs
+}
+
+// cleanConsoleDir empties the output directory dir of console for --clean,
+// logging what it did. It refuses to touch the ROM folder itself.
+func cleanConsoleDir(dir, romDir, console string) {
+	if filepath.Clean(dir) == filepath.Clean(romDir) {
+		logger.Printf("Not cleaning %s: images are written into the ROM folder\n", dir)
+		return
+	}
+	n, err := cleanOutputDir(dir, console)
+	if err != nil {
+		logger.Printf("Not cleaning %s: %s\n", dir, err)
+	}
+	if n > 0 {
+		logger.Printf("%s: removed %d old files from %s\n", console, n, dir)
+	}
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// writeFiles creates empty files with the given names, relative to dir.
+func writeFiles(t *testing.T, dir string, names ...string) {
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// listFiles returns the names of all files below dir, relative to it.
+func listFiles(t *testing.T, dir string) []string {
+	var names []string
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestIsCleanable(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     bool
+	}{
+		{"Tetris.png", true},
+		{"Tetris.JPG", true},
+		{"Tetris.gif", true},
+		{"gb.json", true},
+		{"gb_atlas.json", true},
+		{checksumsFileName, true},
+		{"gbc.json", false},
+		{"notes.txt", false},
+		{"Tetris.gb", false},
+		{managedMarker, false},
+		{ignoreFileName, false},
+	}
+	for _, tt := range tests {
+		if got := isCleanable(tt.filename, "gb"); got != tt.want {
+			t.Errorf("isCleanable(%q, \"gb\") = %v, want %v", tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestCleanOutputDir(t *testing.T) {
+	files := []string{"A.png", "B.jpg", "gb.json", checksumsFileName, "notes.txt", "keep/C.png"}
+
+	dir := t.TempDir()
+	writeFiles(t, dir, files...)
+	if n, err := cleanOutputDir(dir, "gb"); n != 0 || err == nil {
+		t.Errorf("cleaning a directory without marker = %d, %v; want 0 and an error", n, err)
+	}
+	if got := listFiles(t, dir); len(got) != len(files) {
+		t.Errorf("cleaning a directory without marker left %v, want all of %v", got, files)
+	}
+
+	writeFiles(t, dir, managedMarker)
+	n, err := cleanOutputDir(dir, "gb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("removed %d files, want 4", n)
+	}
+	// Other files and subdirectories are left alone.
+	want := []string{managedMarker, "keep/C.png", "notes.txt"}
+	if got := listFiles(t, dir); !equalStrings(got, want) {
+		t.Errorf("left %v, want %v", got, want)
+	}
+
+	if n, err := cleanOutputDir(filepath.Join(dir, "missing"), "gb"); n != 0 || err != nil {
+		t.Errorf("cleaning a missing directory = %d, %v; want 0, nil", n, err)
+	}
+}
+
+func TestCleanConsoleDirSparesROMFolder(t *testing.T) {
+	romDir := t.TempDir()
+	files := []string{managedMarker, "Tetris.gb", "Tetris.png"}
+	writeFiles(t, romDir, files...)
+	// Images written into the ROM folder itself are never removed, marked
+	// or not, however the path is spelled.
+	cleanConsoleDir(romDir+string(filepath.Separator)+".", romDir, "gb")
+	if got := listFiles(t, romDir); len(got) != len(files) {
+		t.Errorf("cleaning the ROM folder left %v, want all of %v", got, files)
+	}
+}
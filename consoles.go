@@ -0,0 +1,369 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// splitList splits a comma-separated list, ignoring commas inside braces.
+func splitList(s string) []string {
+	var res []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			if depth > 0 {
+				depth--
+			}
+		case ',':
+			if depth == 0 {
+				res = append(res, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(res, s[start:])
+}
+
+// parseMap parses a comma-separated list of key=value pairs.
+func parseMap(s string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, part := range strings.Split(s, ",") {
+		if len(strings.TrimSpace(part)) == 0 {
+			continue
+		}
+		key, val, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("Invalid entry %q, expected key=value", part)
+		}
+		m[strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+	return m, nil
+}
+
+// expandBraces expands the first brace group in pattern, e.g. "mame{2000,2003}"
+// becomes "mame2000" and "mame2003", and recurses for the remaining groups.
+func expandBraces(pattern string) []string {
+	open := strings.IndexByte(pattern, '{')
+	if open < 0 {
+		return []string{pattern}
+	}
+	depth := 0
+	for i := open; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				var res []string
+				for _, alt := range splitList(pattern[open+1 : i]) {
+					res = append(res, expandBraces(pattern[:open]+alt+pattern[i+1:])...)
+				}
+				return res
+			}
+		}
+	}
+	// Unbalanced braces are taken literally.
+	return []string{pattern}
+}
+
+// defaultIgnoredConsoles are the patterns of directories in the ROM
+// directory that hold no ROMs of a console.
+var defaultIgnoredConsoles = []string{".*", "bios", "media", "imgs", "saves", "states"}
+
+// expandConsoles turns the --consoles list into console names. Glob
+// patterns like "*" or "mame*", and "all", which is the same as "*", are
+// matched against the directories in romDir, except for those matching
+// one of the ignore patterns. Consoles given by name are never ignored.
+func expandConsoles(romDir, list string, ignore []string) []string {
+	var res []string
+	seen := make(map[string]bool)
+	add := func(c string) {
+		if !seen[c] {
+			seen[c] = true
+			res = append(res, c)
+		}
+	}
+
+	for _, spec := range splitList(list) {
+		for _, c := range expandBraces(strings.TrimSpace(spec)) {
+			if len(c) == 0 {
+				continue
+			}
+			if c == "all" {
+				c = "*"
+			}
+			if !strings.ContainsAny(c, "*?[") {
+				add(c)
+				continue
+			}
+			matches, err := filepath.Glob(filepath.Join(romDir, c))
+			if err != nil {
+				logger.Printf("Invalid console pattern %q: %s\n", c, err)
+				continue
+			}
+			if len(matches) == 0 {
+				logger.Printf("No consoles match %q\n", c)
+			}
+			sort.Strings(matches)
+			for _, m := range matches {
+				name := filepath.Base(m)
+				if matchesConsole(ignore, strings.ToLower(name)) {
+					continue
+				}
+				if fi, err := os.Stat(m); err == nil && fi.IsDir() {
+					add(name)
+				}
+			}
+		}
+	}
+	return res
+}
+
+// defaultConsoleAliases are groups of names different communities and
+// artwork packs use for the same console.
+var defaultConsoleAliases = [][]string{
+	{"genesis", "megadrive", "md"},
+	{"snes", "sfc", "supernes", "superfamicom"},
+	{"nes", "fc", "famicom"},
+	{"pce", "pcengine", "tg16", "turbografx16"},
+	{"sms", "mastersystem"},
+	{"gg", "gamegear"},
+	{"segacd", "megacd"},
+	{"32x", "sega32x"},
+	{"psx", "ps", "ps1", "playstation"},
+	{"ngp", "neogeopocket"},
+	{"ws", "wonderswan"},
+	{"lynx", "atarilynx"},
+	{"a2600", "atari2600"},
+}
+
+// defaultRomExts are the extensions of ROM files per console. Anything else
+// in a ROM folder, like BIOS images or saves, is skipped. Consoles that are
+// not listed get all files processed.
+var defaultRomExts = map[string][]string{
+	"gb":       {".gb", ".zip", ".7z"},
+	"gbc":      {".gbc", ".gb", ".zip", ".7z"},
+	"gba":      {".gba", ".zip", ".7z"},
+	"nes":      {".nes", ".fds", ".unf", ".unif", ".zip", ".7z"},
+	"snes":     {".sfc", ".smc", ".fig", ".swc", ".zip", ".7z"},
+	"genesis":  {".md", ".gen", ".smd", ".bin", ".zip", ".7z"},
+	"sms":      {".sms", ".zip", ".7z"},
+	"gg":       {".gg", ".zip", ".7z"},
+	"pce":      {".pce", ".cue", ".chd", ".zip", ".7z"},
+	"n64":      {".n64", ".z64", ".v64", ".zip", ".7z"},
+	"nds":      {".nds", ".zip", ".7z"},
+	"psx":      {".cue", ".chd", ".pbp", ".m3u", ".iso", ".ecm"},
+	"ngp":      {".ngp", ".ngc", ".zip", ".7z"},
+	"ws":       {".ws", ".wsc", ".zip", ".7z"},
+	"lynx":     {".lnx", ".zip", ".7z"},
+	"a2600":    {".a26", ".bin", ".zip", ".7z"},
+	"arcade":   {".zip", ".7z"},
+	"mame2000": {".zip", ".7z"},
+	"mame2003": {".zip", ".7z"},
+}
+
+// parseRomExts parses a comma-separated list of console=ext:ext... entries,
+// like "gb=gb:zip,psx=chd". "*" as the extension list processes all files.
+func parseRomExts(s string) (map[string][]string, error) {
+	m, err := parseMap(s)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string][]string)
+	for console, list := range m {
+		exts := []string{}
+		for _, e := range strings.Split(list, ":") {
+			e = strings.ToLower(strings.TrimSpace(e))
+			if e == "*" {
+				exts = nil
+				break
+			}
+			if len(e) == 0 {
+				return nil, fmt.Errorf("Empty extension for %s", console)
+			}
+			exts = append(exts, "."+strings.TrimPrefix(e, "."))
+		}
+		res[console] = exts
+	}
+	return res, nil
+}
+
+// isRomFile reports whether filename has one of the ROM extensions of
+// console, looking at its aliases if the console itself is unknown.
+func (opts *Options) isRomFile(console, filename string) bool {
+	exts, ok := opts.RomExts[console]
+	if !ok {
+		for _, alias := range opts.Aliases[console] {
+			if exts, ok = opts.RomExts[alias]; ok {
+				break
+			}
+		}
+	}
+	if !ok || exts == nil {
+		return true
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	if opts.PlaylistCollage && ext == ".m3u" {
+		return true
+	}
+	for _, e := range exts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// consoleAliases maps a console name to its other names, in order of
+// preference.
+type consoleAliases map[string][]string
+
+// add makes all names aliases of each other.
+func (a consoleAliases) add(names ...string) {
+	for _, n := range names {
+		for _, other := range names {
+			if other == n {
+				continue
+			}
+			found := false
+			for _, e := range a[n] {
+				found = found || e == other
+			}
+			if !found {
+				a[n] = append(a[n], other)
+			}
+		}
+	}
+}
+
+// newConsoleAliases returns the default aliases, extended by the pairs in
+// extra.
+func newConsoleAliases(extra map[string]string) consoleAliases {
+	a := make(consoleAliases)
+	for _, g := range defaultConsoleAliases {
+		a.add(g...)
+	}
+	keys := make([]string, 0, len(extra))
+	for k := range extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		a.add(k, extra[k])
+	}
+	return a
+}
+
+// hasFiles reports whether dir is a directory with at least one entry.
+func hasFiles(dir string) bool {
+	f, err := os.Open(dir)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	names, _ := f.Readdirnames(1)
+	return len(names) > 0
+}
+
+// parsePriorities parses a comma-separated list of console=priority pairs.
+// Consoles may be glob patterns.
+func parsePriorities(s string) (map[string]int, error) {
+	m, err := parseMap(s)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]int)
+	for pattern, p := range m {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("Invalid pattern %q", pattern)
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid priority %q for %s", p, pattern)
+		}
+		res[pattern] = n
+	}
+	return res, nil
+}
+
+// consolePriority returns the highest priority of all patterns matching
+// console, or 0 if there are none.
+func consolePriority(priorities map[string]int, console string) int {
+	prio, found := 0, false
+	for pattern, p := range priorities {
+		if ok, _ := filepath.Match(pattern, console); ok && (!found || p > prio) {
+			prio, found = p, true
+		}
+	}
+	return prio
+}
+
+// prioritize sorts consoles by descending priority. Consoles with the same
+// priority stay in the order they were given in.
+func prioritize(consoles []string, priorities map[string]int) {
+	sort.SliceStable(consoles, func(i, j int) bool {
+		return consolePriority(priorities, consoles[i]) > consolePriority(priorities, consoles[j])
+	})
+}
+
+// consoleName returns the console name for the ROM folder folder.
+func (opts *Options) consoleName(folder string) string {
+	if name, ok := opts.ConsoleMap[folder]; ok {
+		return name
+	}
+	return folder
+}
+
+// matchesConsole reports whether console matches any of the glob patterns.
+func matchesConsole(patterns []string, console string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, console); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// forConsole returns the options to generate the images of console with:
+// opts itself, or a copy with the console's overrides applied.
+func (opts *Options) forConsole(console string) *Options {
+	centerFull := matchesConsole(opts.CenterFull, console)
+	noUniformHeight := opts.UniformHeight > 0 && len(opts.UniformHeightConsoles) > 0 && !matchesConsole(opts.UniformHeightConsoles, console)
+	if !centerFull && !noUniformHeight {
+		return opts
+	}
+	o := *opts
+	if centerFull {
+		o.Variants = append([]Variant(nil), opts.Variants...)
+		o.Variants[0].Layout = centeredLayout(o.CanvasW, o.CanvasH, o.CenterFullMax)
+	}
+	if noUniformHeight {
+		o.UniformHeight = 0
+	}
+	return &o
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExpandConsoles(t *testing.T) {
+	romDir := t.TempDir()
+	for _, d := range []string{"gb", "gba", "gbc", "mame2000", "mame2003", "media", "Imgs", ".git"} {
+		if err := os.Mkdir(filepath.Join(romDir, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Files are no consoles.
+	writeFiles(t, romDir, "gbx", "readme.txt")
+
+	tests := []struct {
+		list string
+		want []string
+	}{
+		{"gb,gbc", []string{"gb", "gbc"}},
+		{" gb , gb ", []string{"gb"}},
+		{"gb*", []string{"gb", "gba", "gbc"}},
+		{"mame*,gb", []string{"mame2000", "mame2003", "gb"}},
+		{"all", []string{"gb", "gba", "gbc", "mame2000", "mame2003"}},
+		{"*", []string{"gb", "gba", "gbc", "mame2000", "mame2003"}},
+		{"gb{a,c}", []string{"gba", "gbc"}},
+		// Consoles given by name are never ignored, nor need to exist.
+		{"media,psx", []string{"media", "psx"}},
+		{"nes*", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := expandConsoles(romDir, tt.list, defaultIgnoredConsoles); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("expandConsoles(%q) = %q, want %q", tt.list, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// coverageRow counts the ROMs of a console with and without artwork.
+type coverageRow struct {
+	console      string
+	roms, hasArt int
+}
+
+func (r coverageRow) percent() float64 {
+	if r.roms == 0 {
+		return 0
+	}
+	return float64(r.hasArt) * 100 / float64(r.roms)
+}
+
+// hasArtwork reports whether findGameArtwork would find artwork for game
+// in mediaDir, by the same names and tiers, without decoding it.
+func (opts *Options) hasArtwork(mediaDir, console, game string) bool {
+	_, names := gameNames(opts, game)
+	if opts.MatchTiers[matchExact] {
+		for _, name := range names {
+			if opts.artworkExists(mediaDir, console, name) {
+				return true
+			}
+		}
+	}
+	if opts.MatchTiers[matchTitle] && console != "mame2000" {
+		for _, name := range names {
+			files := preferRegions(opts.titles.lookup(mediaDir, name), opts.RegionPriority)
+			if len(files) == 1 || len(files) > 1 && opts.OnAmbiguous != ambiguousSkip {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// artworkExists reports whether findArtwork would find artwork named name,
+// without decoding it.
+func (opts *Options) artworkExists(mediaDir, console, name string) bool {
+	if opts.ArtDB != nil {
+		path, err := opts.ArtDB.lookup(console, name)
+		if err == nil {
+			return fileExists(path)
+		}
+		if err != sql.ErrNoRows {
+			logger.Printf("Can't look up %s/%s in database: %s\n", console, name, err)
+		}
+	}
+	if opts.ArtManifest != nil {
+		if entry := opts.ArtManifest.lookup(console, name); len(entry) > 0 {
+			// Inline data is only checked when it is decoded.
+			return strings.HasPrefix(entry, "data:") || fileExists(opts.ArtManifest.resolve(entry))
+		}
+	}
+	if opts.Resolver != nil {
+		if rc, err := opts.Resolver.Resolve(console, name); err == nil {
+			rc.Close()
+			return true
+		}
+	}
+	if rc, err := artworkResolver(mediaDir, opts.MameExtrasDir, console).Resolve(console, name); err == nil {
+		rc.Close()
+		return true
+	}
+	if opts.VideoFrame != nil {
+		for _, ext := range videoExts {
+			if fileExists(filepath.Join(mediaDir, name+ext)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// consoleCoverage counts the ROMs in folder that have artwork for the main
+// image.
+func consoleCoverage(opts *Options, folder string) (coverageRow, error) {
+	romDir := filepath.Join(opts.RomDir, folder)
+	console := opts.consoleName(folder)
+	opts = opts.forConsole(console)
+	row := coverageRow{console: console}
+	files, err := romFiles(opts, romDir, console)
+	if err != nil {
+		return row, err
+	}
+	mediaDir := opts.Variants[0].consoleMediaDir(console, opts.Aliases)
+	for _, filename := range files {
+		game := trimExt(filename)
+		if opts.Games != nil && !opts.Games.match(filename, game) {
+			continue
+		}
+		row.roms++
+		if opts.hasArtwork(mediaDir, console, game) {
+			row.hasArt++
+		}
+	}
+	return row, nil
+}
+
+// writeCoverage writes a table of how many ROMs of each of consoles have
+// artwork to w. It returns the number of consoles that couldn't be read.
+func writeCoverage(w io.Writer, opts *Options, consoles []string) int {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "console\tROMs\twith art\twithout\tcoverage\t")
+	total := coverageRow{console: "total"}
+	failed := 0
+	for _, c := range consoles {
+		row, err := consoleCoverage(opts, c)
+		if err != nil {
+			logger.Printf("Can't read ROMs of %s: %s\n", c, err)
+			failed++
+			continue
+		}
+		total.roms += row.roms
+		total.hasArt += row.hasArt
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%.1f%%\t\n", row.console, row.roms, row.hasArt, row.roms-row.hasArt, row.percent())
+	}
+	fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%.1f%%\t\n", total.console, total.roms, total.hasArt, total.roms-total.hasArt, total.percent())
+	tw.Flush()
+	return failed
+}
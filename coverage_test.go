@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArtworkExists(t *testing.T) {
+	extras := t.TempDir()
+	writeTar(t, filepath.Join(extras, "titles.tar"), false, "pacman")
+	writeTar(t, filepath.Join(extras, "titles.tgz"), true, "galaga")
+	mediaDir := t.TempDir()
+	for _, name := range []string{"Tetris.png", "Zelda.mp4"} {
+		if err := os.WriteFile(filepath.Join(mediaDir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		videoFrame bool
+		console    string
+		game       string
+		want       bool
+	}{
+		{"first archive", false, "mame2000", "pacman", true},
+		{"later archive", false, "mame2000", "galaga", true},
+		{"in no archive", false, "mame2000", "dkong", false},
+		{"image", false, "gb", "Tetris", true},
+		{"video without --video_frame", false, "gb", "Zelda", false},
+		{"video", true, "gb", "Zelda", true},
+		{"nothing", true, "gb", "Metroid", false},
+	}
+	for _, tt := range tests {
+		opts := &Options{MameExtrasDir: extras}
+		if tt.videoFrame {
+			opts.VideoFrame = &videoFrame{}
+		}
+		if got := opts.artworkExists(mediaDir, tt.console, tt.game); got != tt.want {
+			t.Errorf("%s: artworkExists(%s/%s) = %v, want %v", tt.name, tt.console, tt.game, got, tt.want)
+		}
+	}
+}
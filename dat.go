@@ -0,0 +1,263 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// datEntry is a game as described in a DAT file.
+type datEntry struct {
+	Name        string
+	Description string
+	// CloneOf is the name of the parent set if the game is a clone.
+	CloneOf string
+}
+
+// datIndex maps ROM names (without extension) to their DAT entries.
+type datIndex map[string]datEntry
+
+type logiqxGame struct {
+	Name        string `xml:"name,attr"`
+	CloneOf     string `xml:"cloneof,attr"`
+	Description string `xml:"description"`
+	Roms        []struct {
+		Name string `xml:"name,attr"`
+	} `xml:"rom"`
+}
+
+type logiqxDat struct {
+	Games    []logiqxGame `xml:"game"`
+	Machines []logiqxGame `xml:"machine"`
+}
+
+func (idx datIndex) add(name, description, cloneOf string, roms []string) {
+	if len(name) == 0 {
+		return
+	}
+	if len(description) == 0 {
+		description = name
+	}
+	e := datEntry{Name: name, Description: description, CloneOf: cloneOf}
+	// Arcade sets are named after the game, so the game name is a valid
+	// key as well.
+	idx[name] = e
+	for _, rom := range roms {
+		key := trimExt(filepath.Base(rom))
+		// Clones share ROMs with their parent, so a ROM name must neither
+		// replace a set of that name nor take it away from the parent.
+		if old, ok := idx[key]; ok && (old.Name == key || old.Name == cloneOf) {
+			continue
+		}
+		idx[key] = e
+	}
+}
+
+// loadDats reads all the given DAT files into one index. Entries from
+// later files win.
+func loadDats(paths []string) (datIndex, error) {
+	idx := make(datIndex)
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+			err = idx.parseLogiqx(data)
+		} else {
+			err = idx.parseClrMamePro(data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+	}
+	return idx, nil
+}
+
+func (idx datIndex) parseLogiqx(data []byte) error {
+	var dat logiqxDat
+	if err := xml.Unmarshal(data, &dat); err != nil {
+		return err
+	}
+	for _, g := range append(dat.Games, dat.Machines...) {
+		var roms []string
+		for _, r := range g.Roms {
+			roms = append(roms, r.Name)
+		}
+		idx.add(g.Name, g.Description, g.CloneOf, roms)
+	}
+	return nil
+}
+
+// cmpTokenize splits a ClrMamePro DAT into parens, words, and quoted strings.
+// Quoted strings are returned without quotes.
+func cmpTokenize(data string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"':
+			end := strings.IndexByte(data[i+1:], '"')
+			if end < 0 {
+				return nil, errors.New("Unterminated string")
+			}
+			tokens = append(tokens, data[i+1:i+1+end])
+			i += end + 2
+		default:
+			start := i
+			for i < len(data) && !unicode.IsSpace(rune(data[i])) && data[i] != '(' && data[i] != ')' {
+				i++
+			}
+			tokens = append(tokens, data[start:i])
+		}
+	}
+	return tokens, nil
+}
+
+func (idx datIndex) parseClrMamePro(data []byte) error {
+	tokens, err := cmpTokenize(string(data))
+	if err != nil {
+		return err
+	}
+	pos := 0
+	next := func() (string, error) {
+		if pos >= len(tokens) {
+			return "", errors.New("Unexpected end of file")
+		}
+		pos++
+		return tokens[pos-1], nil
+	}
+	// skipBlock skips everything up to and including the closing paren of
+	// a block whose opening paren was already consumed.
+	skipBlock := func() error {
+		for depth := 1; depth > 0; {
+			t, err := next()
+			if err != nil {
+				return err
+			}
+			if t == "(" {
+				depth++
+			} else if t == ")" {
+				depth--
+			}
+		}
+		return nil
+	}
+
+	for pos < len(tokens) {
+		kind, _ := next()
+		if t, err := next(); err != nil || t != "(" {
+			return fmt.Errorf("Expected '(' after %q", kind)
+		}
+		if kind != "game" && kind != "machine" && kind != "resource" {
+			if err := skipBlock(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var name, description, cloneOf string
+		var roms []string
+		for {
+			key, err := next()
+			if err != nil {
+				return err
+			}
+			if key == ")" {
+				break
+			}
+			val, err := next()
+			if err != nil {
+				return err
+			}
+			if val != "(" {
+				switch key {
+				case "name":
+					name = val
+				case "description":
+					description = val
+				case "cloneof":
+					cloneOf = val
+				}
+				continue
+			}
+			// Nested block, e.g. rom ( name "x.gb" size 1234 )
+			for {
+				k, err := next()
+				if err != nil {
+					return err
+				}
+				if k == ")" {
+					break
+				}
+				v, err := next()
+				if err != nil {
+					return err
+				}
+				if v == "(" {
+					if err := skipBlock(); err != nil {
+						return err
+					}
+					continue
+				}
+				if key == "rom" && k == "name" {
+					roms = append(roms, v)
+				}
+			}
+		}
+		idx.add(name, description, cloneOf, roms)
+	}
+	return nil
+}
+
+// loadParents reads a CSV file of "clone,parent" lines. Lines starting with
+// '#' are ignored.
+func loadParents(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = 2
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	parents := make(map[string]string)
+	for _, rec := range records {
+		parents[strings.TrimSpace(rec[0])] = strings.TrimSpace(rec[1])
+	}
+	return parents, nil
+}
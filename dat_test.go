@@ -0,0 +1,44 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import "testing"
+
+func TestDatIndexAdd(t *testing.T) {
+	idx := make(datIndex)
+	idx.add("puckman", "Puck Man", "", []string{"namcopac.6e", "82s123.7f"})
+	idx.add("pacman", "Pac-Man", "puckman", []string{"pacman.6e", "82s123.7f"})
+	idx.add("pacmanf", "Pac-Man (fast)", "puckman", []string{"pacman.6e", "pacmanf.6f", "82s123.7f"})
+
+	tests := []struct {
+		key, want string
+	}{
+		// pacmanf's pacman.6e doesn't replace the pacman set.
+		{"pacman", "pacman"},
+		{"puckman", "puckman"},
+		{"pacmanf", "pacmanf"},
+		{"namcopac", "puckman"},
+		// Clones don't take shared ROMs away from their parent.
+		{"82s123", "puckman"},
+	}
+	for _, tt := range tests {
+		if got := idx[tt.key].Name; got != tt.want {
+			t.Errorf("idx[%q].Name = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+)
+
+// sqliteDriver is the name of the database/sql driver used for --db. It is
+// only set if the binary was built with "-tags sqlite", see db_sqlite.go.
+var sqliteDriver string
+
+const defaultDBQuery = "SELECT path FROM media WHERE console = :console AND game = :game"
+
+// artDB resolves games to artwork files via a scraper database.
+type artDB struct {
+	db    *sql.DB
+	query string
+	// dir is the directory relative paths in the database are resolved
+	// against.
+	dir string
+}
+
+func openArtDB(path, query string) (*artDB, error) {
+	if len(sqliteDriver) == 0 {
+		return nil, errors.New("This binary was built without SQLite support; rebuild with -tags sqlite")
+	}
+	db, err := sql.Open(sqliteDriver, path)
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &artDB{db: db, query: query, dir: filepath.Dir(path)}, nil
+}
+
+// lookup returns the artwork path stored for a game. The query gets the
+// named parameters "console" and "game" and must return a single column.
+func (a *artDB) lookup(console, game string) (string, error) {
+	var path string
+	err := a.db.QueryRow(a.query, sql.Named("console", console), sql.Named("game", game)).Scan(&path)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(a.dir, path)
+	}
+	return path, nil
+}
+
+func (a *artDB) Close() error {
+	return a.db.Close()
+}
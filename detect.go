@@ -0,0 +1,178 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// romDirNames are the names ROM directories commonly have below the root of
+// a device.
+var romDirNames = []string{"", "Roms", "ROMS", "roms"}
+
+// mediaDirNames are the names scraped media directories commonly have inside
+// the ROM directory.
+var mediaDirNames = []string{"media", "Media", "downloaded_media"}
+
+// muosCatalogue is where muOS keeps its images, relative to the device root.
+var muosCatalogue = filepath.Join("MUOS", "info", "catalogue")
+
+// detectedLayout is the configuration inferred from an existing install.
+type detectedLayout struct {
+	RomDir     string
+	Consoles   []string
+	MediaDir   string
+	Frontend   string
+	OutputRoot string
+}
+
+// isDir reports whether path is a directory.
+func isDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
+// consoleDirs returns the subdirectories of romDir that contain ROMs.
+func consoleDirs(romDir string) []string {
+	entries, err := ioutil.ReadDir(romDir)
+	if err != nil {
+		return nil
+	}
+	var consoles []string
+	for _, e := range entries {
+		if !e.IsDir() || isJunkFile(e.Name()) {
+			continue
+		}
+		files, err := ioutil.ReadDir(filepath.Join(romDir, e.Name()))
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			if !f.IsDir() && !isJunkFile(f.Name()) && f.Name() != ignoreFileName {
+				consoles = append(consoles, e.Name())
+				break
+			}
+		}
+	}
+	return consoles
+}
+
+// detectLayout inspects a device or frontend directory and infers where the
+// ROMs and media are, and which frontend layout the images should use.
+func detectLayout(root string) (*detectedLayout, error) {
+	if !isDir(root) {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+	var l detectedLayout
+	for _, name := range romDirNames {
+		dir := filepath.Join(root, name)
+		consoles := consoleDirs(dir)
+		var media string
+		for _, m := range mediaDirNames {
+			if isDir(filepath.Join(dir, m)) {
+				media = m
+				break
+			}
+		}
+		if len(media) > 0 {
+			// Media directories look like consoles, too.
+			for i, c := range consoles {
+				if c == media {
+					consoles = append(consoles[:i], consoles[i+1:]...)
+					break
+				}
+			}
+		}
+		if len(consoles) > len(l.Consoles) {
+			l = detectedLayout{RomDir: dir, Consoles: consoles, MediaDir: media}
+		}
+	}
+	if len(l.Consoles) == 0 {
+		return nil, errors.New("no console directories found")
+	}
+
+	if catalogue := filepath.Join(root, muosCatalogue); isDir(catalogue) {
+		l.Frontend = "muos"
+		l.OutputRoot = catalogue
+		return &l, nil
+	}
+	// Pick the frontend whose image directories exist for most consoles.
+	var names []string
+	for name := range frontends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	best := 0
+	for _, name := range names {
+		n := 0
+		for _, c := range l.Consoles {
+			if isDir(filepath.Join(l.RomDir, c, frontends[name].ImgDir)) {
+				n++
+			}
+		}
+		if n > best {
+			best = n
+			l.Frontend = name
+		}
+	}
+	return &l, nil
+}
+
+// shellQuote quotes s for a POSIX shell if needed.
+func shellQuote(s string) string {
+	if len(s) > 0 && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("/._-,+:=", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// printDetected writes the command line for l to w.
+func printDetected(w io.Writer, l *detectedLayout) {
+	fmt.Fprintf(w, "# Consoles found in %s: %d\n", l.RomDir, len(l.Consoles))
+	args := [][2]string{
+		{"rom_dir", l.RomDir},
+		{"consoles", strings.Join(l.Consoles, ",")},
+	}
+	if len(l.MediaDir) > 0 {
+		args = append(args, [2]string{"media_dir", l.MediaDir})
+	} else {
+		fmt.Fprintf(w, "# No media directory found; set --media_dir or --media_map\n")
+	}
+	if len(l.Frontend) > 0 {
+		args = append(args, [2]string{"frontend", l.Frontend})
+	} else {
+		fmt.Fprintf(w, "# No existing images found; using the stock layout\n")
+	}
+	if len(l.OutputRoot) > 0 {
+		args = append(args, [2]string{"output_root", l.OutputRoot})
+	}
+	fmt.Fprint(w, filepath.Base(os.Args[0]))
+	for _, a := range args {
+		fmt.Fprintf(w, " \\\n  --%s %s", a[0], shellQuote(a[1]))
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// outputDiff compares the images a run would write with the ones already
+// on disk for --diff.
+type outputDiff struct {
+	added, changed, unchanged int
+	// seen holds all output paths of the run, whether an image could be
+	// generated for them or not.
+	seen map[string]bool
+}
+
+func newOutputDiff() *outputDiff {
+	return &outputDiff{seen: make(map[string]bool)}
+}
+
+// compare encodes img and compares it byte by byte with the file at path,
+// logging if it would be added or changed.
+func (d *outputDiff) compare(path string, img image.Image, encode func(io.Writer, image.Image) error) error {
+	var buf bytes.Buffer
+	if err := encode(&buf, img); err != nil {
+		return err
+	}
+	existing, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		logger.Printf("Would add %s\n", path)
+		d.added++
+	case err != nil:
+		return err
+	case bytes.Equal(existing, buf.Bytes()):
+		d.unchanged++
+	default:
+		logger.Printf("Would change %s\n", path)
+		d.changed++
+	}
+	return nil
+}
+
+// removed returns the images in dir that the run would not write, e.g.
+// because their ROMs are gone.
+func (d *outputDiff) removed(dir string) []string {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var res []string
+	for _, f := range files {
+		path := filepath.Join(dir, f.Name())
+		if !f.Mode().IsRegular() || d.seen[path] || !isImageFile(f.Name()) {
+			continue
+		}
+		res = append(res, path)
+	}
+	return res
+}
+
+// isImageFile reports whether filename has the extension of one of the
+// supported output formats or of animated previews.
+func isImageFile(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == animatedExt {
+		return true
+	}
+	for _, f := range imageFormats {
+		if ext == f.Ext {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,389 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// drawBorder draws a stroke of the given width around r. The stroke lies
+// outside of r unless that would leave dst's bounds, in which case it is
+// moved inwards on that side.
+func drawBorder(dst draw.Image, r image.Rectangle, width int, c color.Color) {
+	if width <= 0 {
+		return
+	}
+	outer := r.Inset(-width).Intersect(dst.Bounds())
+	inner := image.Rect(
+		maxInt(r.Min.X, outer.Min.X+width),
+		maxInt(r.Min.Y, outer.Min.Y+width),
+		minInt(r.Max.X, outer.Max.X-width),
+		minInt(r.Max.Y, outer.Max.Y-width),
+	)
+	src := image.NewUniform(c)
+	for _, side := range []image.Rectangle{
+		image.Rect(outer.Min.X, outer.Min.Y, outer.Max.X, inner.Min.Y),
+		image.Rect(outer.Min.X, inner.Max.Y, outer.Max.X, outer.Max.Y),
+		image.Rect(outer.Min.X, inner.Min.Y, inner.Min.X, inner.Max.Y),
+		image.Rect(inner.Max.X, inner.Min.Y, outer.Max.X, inner.Max.Y),
+	} {
+		draw.Draw(dst, side, src, image.Point{}, draw.Over)
+	}
+}
+
+// drawArtBorder draws the border of opts around r, following the rounded
+// corners of CornerRadius.
+func (opts *Options) drawArtBorder(dst draw.Image, r image.Rectangle) {
+	if opts.CornerRadius <= 0 {
+		drawBorder(dst, r, opts.BorderWidth, opts.BorderColor)
+		return
+	}
+	drawRoundedBorder(dst, r, opts.BorderWidth, opts.CornerRadius, opts.BorderColor, opts.AA)
+}
+
+// drawRoundedBorder is drawBorder for a rectangle with corners rounded by
+// radius. The stroke's outer corners are rounded by radius+width, so that
+// it has the same width everywhere. Edges are antialiased by sampling
+// every pixel aa x aa times.
+func drawRoundedBorder(dst draw.Image, r image.Rectangle, width, radius int, c color.Color, aa int) {
+	if width <= 0 {
+		return
+	}
+	outer := r.Inset(-width).Intersect(dst.Bounds())
+	inner := image.Rect(
+		maxInt(r.Min.X, outer.Min.X+width),
+		maxInt(r.Min.Y, outer.Min.Y+width),
+		minInt(r.Max.X, outer.Max.X-width),
+		minInt(r.Max.Y, outer.Max.Y-width),
+	)
+	mask := image.NewAlpha(outer)
+	for y := outer.Min.Y; y < outer.Max.Y; y++ {
+		for x := outer.Min.X; x < outer.Max.X; x++ {
+			cov := roundedCoverage(outer, radius+width, x, y, aa)
+			if x >= inner.Min.X && x < inner.Max.X && y >= inner.Min.Y && y < inner.Max.Y {
+				cov -= roundedCoverage(inner, radius, x, y, aa)
+			}
+			mask.SetAlpha(x, y, color.Alpha{uint8(math.Round(math.Max(0, cov) * 0xff))})
+		}
+	}
+	draw.DrawMask(dst, outer, image.NewUniform(c), image.Point{}, mask, outer.Min, draw.Over)
+}
+
+// roundedMask returns a mask that is opaque inside r and transparent
+// outside of it, with its corners rounded by radius and antialiased by
+// sampling every pixel aa x aa times.
+func roundedMask(r image.Rectangle, radius, aa int) *image.Alpha {
+	mask := image.NewAlpha(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			mask.SetAlpha(x, y, color.Alpha{uint8(math.Round(roundedCoverage(r, radius, x, y, aa) * 0xff))})
+		}
+	}
+	return mask
+}
+
+// roundedCoverage returns the fraction of the pixel at x, y that lies
+// inside r with its corners rounded by radius. The pixel is sampled aa x aa
+// times; with aa <= 1, only its center is, which gives hard edges.
+func roundedCoverage(r image.Rectangle, radius, x, y, aa int) float64 {
+	rad := math.Min(float64(radius), float64(minInt(r.Dx(), r.Dy()))/2)
+	// Distance of the pixel from the rectangle the corner circles are
+	// centered on.
+	cx, cy := float64(r.Min.X)+rad, float64(r.Min.Y)+rad
+	cx2, cy2 := float64(r.Max.X)-rad, float64(r.Max.Y)-rad
+	if float64(x) >= cx && float64(x+1) <= cx2 || float64(y) >= cy && float64(y+1) <= cy2 {
+		// Not in a corner.
+		if image.Pt(x, y).In(r) {
+			return 1
+		}
+		return 0
+	}
+	aa = maxInt(1, aa)
+	inside := 0
+	for i := 0; i < aa; i++ {
+		py := float64(y) + (float64(i)+0.5)/float64(aa)
+		for j := 0; j < aa; j++ {
+			px := float64(x) + (float64(j)+0.5)/float64(aa)
+			dx := px - math.Max(cx, math.Min(px, cx2))
+			dy := py - math.Max(cy, math.Min(py, cy2))
+			if dx*dx+dy*dy <= rad*rad {
+				inside++
+			}
+		}
+	}
+	return float64(inside) / float64(aa*aa)
+}
+
+// newImageLike returns an empty image with bounds r and the same bit depth
+// as img.
+func newImageLike(img image.Image, r image.Rectangle) draw.RGBA64Image {
+	if _, ok := img.(*image.RGBA64); ok {
+		return image.NewRGBA64(r)
+	}
+	return image.NewRGBA(r)
+}
+
+// subImage returns the part of img inside r. All image types of the
+// standard library support this.
+func subImage(img draw.Image, r image.Rectangle) draw.Image {
+	return img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}).SubImage(r).(draw.Image)
+}
+
+// scaleColor multiplies the color channels of c by f, and alpha, too, if all
+// is set.
+func scaleColor(c color.RGBA64, f float64, all bool) color.RGBA64 {
+	c.R = uint16(float64(c.R)*f + 0.5)
+	c.G = uint16(float64(c.G)*f + 0.5)
+	c.B = uint16(float64(c.B)*f + 0.5)
+	if all {
+		c.A = uint16(float64(c.A)*f + 0.5)
+	}
+	return c
+}
+
+// applyVignette darkens img towards its edges. The color is multiplied by
+// 1 - strength * d², where d is the distance from the center, normalized
+// to 1 at the corners. Alpha is left alone.
+func applyVignette(img draw.RGBA64Image, strength float64) {
+	b := img.Bounds()
+	cx, cy := float64(b.Min.X+b.Max.X)/2, float64(b.Min.Y+b.Max.Y)/2
+	rx, ry := float64(b.Dx())/2, float64(b.Dy())/2
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		ny := (float64(y) + 0.5 - cy) / ry
+		for x := b.Min.X; x < b.Max.X; x++ {
+			nx := (float64(x) + 0.5 - cx) / rx
+			f := 1 - strength*(nx*nx+ny*ny)/2
+			img.SetRGBA64(x, y, scaleColor(img.RGBA64At(x, y), f, false))
+		}
+	}
+}
+
+// featherEdges fades img out towards its edges: pixels less than width
+// pixels from an edge get their alpha scaled linearly, from (0.5 / width) at
+// the edge itself up to fully opaque.
+func featherEdges(img draw.RGBA64Image, width int) {
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		dy := minInt(y-b.Min.Y, b.Max.Y-1-y)
+		for x := b.Min.X; x < b.Max.X; x++ {
+			d := minInt(dy, minInt(x-b.Min.X, b.Max.X-1-x))
+			if d >= width {
+				continue
+			}
+			f := (float64(d) + 0.5) / float64(width)
+			// Colors are premultiplied, so they fade along with alpha.
+			img.SetRGBA64(x, y, scaleColor(img.RGBA64At(x, y), f, true))
+		}
+	}
+}
+
+// flipVertical returns a copy of img, upside down.
+func flipVertical(img draw.RGBA64Image) draw.RGBA64Image {
+	b := img.Bounds()
+	flipped := newImageLike(img, image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			flipped.SetRGBA64(x, y, img.RGBA64At(b.Min.X+x, b.Max.Y-1-y))
+		}
+	}
+	return flipped
+}
+
+// drawReflection draws a mirrored copy of img below r, where img was drawn.
+// The reflection is fraction times as high as img and fades out from
+// opacity at the top to transparent.
+func drawReflection(dst draw.Image, img draw.RGBA64Image, r image.Rectangle, fraction, opacity float64) {
+	w := img.Bounds().Dx()
+	h := minInt(img.Bounds().Dy(), int(fraction*float64(img.Bounds().Dy())+0.5))
+	if h <= 0 {
+		return
+	}
+	mask := image.NewAlpha16(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		a := color.Alpha16{uint16(opacity*(1-float64(y)/float64(h))*0xffff + 0.5)}
+		for x := 0; x < w; x++ {
+			mask.SetAlpha16(x, y, a)
+		}
+	}
+	target := image.Rect(r.Min.X, r.Max.Y, r.Min.X+w, r.Max.Y+h)
+	draw.DrawMask(dst, target, flipVertical(img), image.Point{}, mask, image.Point{}, draw.Over)
+}
+
+// snapAlpha makes pixels with an alpha of at least hi fully opaque and,
+// if lo > 0, those with an alpha below lo fully transparent. Images that
+// are known to be opaque are returned as they are.
+func snapAlpha(img image.Image, hi, lo uint8) image.Image {
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return img
+	}
+	b := img.Bounds()
+	n := image.NewNRGBA(b)
+	draw.Draw(n, b, img, b.Min, draw.Src)
+	for i := 3; i < len(n.Pix); i += 4 {
+		switch a := n.Pix[i]; {
+		case hi > 0 && a >= hi:
+			n.Pix[i] = 0xff
+		case a < lo:
+			n.Pix[i] = 0
+		}
+	}
+	return n
+}
+
+// blendFuncs are the separable blend modes for layers besides "over" and
+// "replace", which draw handles itself. Each function gets the backdrop
+// and source channel with their alphas, all premultiplied and in 0..1, and
+// returns the resulting premultiplied channel.
+var blendFuncs = map[string]func(cb, ab, cs, as float64) float64{
+	"multiply": func(cb, ab, cs, as float64) float64 {
+		return cs*(1-ab) + cb*(1-as) + cs*cb
+	},
+	"screen": func(cb, ab, cs, as float64) float64 {
+		return cs + cb - cs*cb
+	},
+	"add": func(cb, ab, cs, as float64) float64 {
+		return math.Min(cs+cb, 1)
+	},
+}
+
+// blendImage combines src with dst within r using one of blendFuncs. The
+// resulting alpha is that of src drawn over dst, except for "add", where
+// the alphas add up as well.
+func blendImage(dst, src draw.RGBA64Image, r image.Rectangle, mode string) {
+	f := blendFuncs[mode]
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			s := src.RGBA64At(x, y)
+			if s.A == 0 {
+				continue
+			}
+			b := dst.RGBA64At(x, y)
+			as, ab := float64(s.A)/0xffff, float64(b.A)/0xffff
+			ch := func(cb, cs uint16) uint16 {
+				return uint16(math.Round(f(float64(cb)/0xffff, ab, float64(cs)/0xffff, as) * 0xffff))
+			}
+			a := as + ab - as*ab
+			if mode == "add" {
+				a = math.Min(as+ab, 1)
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{ch(b.R, s.R), ch(b.G, s.G), ch(b.B, s.B), uint16(math.Round(a * 0xffff))})
+		}
+	}
+}
+
+// applyMockup returns the Mockup device with img scaled into its screen,
+// for pictures of the device showing the image. img replaces whatever the
+// mockup shows in the screen rectangle.
+func applyMockup(opts *Options, img image.Image) draw.RGBA64Image {
+	fb := opts.Mockup.Bounds()
+	dst := opts.newImage(image.Rect(0, 0, fb.Dx(), fb.Dy()))
+	draw.Draw(dst, dst.Bounds(), opts.Mockup, fb.Min, draw.Src)
+	b := img.Bounds()
+	r := boxRect(opts.MockupScreen)
+	opts.scalerFor(b.Dx(), b.Dy(), r.Dx(), r.Dy()).Scale(dst, r, img, b, draw.Src, nil)
+	return dst
+}
+
+// blurImage blurs img in place with three passes of a box blur of the given
+// radius, which comes close to a Gaussian blur.
+func blurImage(img draw.RGBA64Image, radius int) {
+	if radius <= 0 {
+		return
+	}
+	b := img.Bounds()
+	for pass := 0; pass < 3; pass++ {
+		boxBlur(img, b.Dx(), b.Dy(), radius, func(i, j int) (int, int) { return b.Min.X + i, b.Min.Y + j })
+		boxBlur(img, b.Dy(), b.Dx(), radius, func(i, j int) (int, int) { return b.Min.X + j, b.Min.Y + i })
+	}
+}
+
+// boxBlur averages every pixel of each of the lines of img with the radius
+// pixels before and after it on the same line. at maps the index i of a
+// pixel on line j to its coordinates, so lines can be rows or columns.
+// Pixels beyond the ends are taken to be copies of the end pixels.
+func boxBlur(img draw.RGBA64Image, length, lines, radius int, at func(i, j int) (int, int)) {
+	line := make([]color.RGBA64, length)
+	n := uint32(2*radius + 1)
+	for j := 0; j < lines; j++ {
+		for i := range line {
+			line[i] = img.RGBA64At(at(i, j))
+		}
+		get := func(i int) color.RGBA64 {
+			return line[maxInt(0, minInt(length-1, i))]
+		}
+		var r, g, bl, a uint32
+		for i := -radius; i <= radius; i++ {
+			c := get(i)
+			r, g, bl, a = r+uint32(c.R), g+uint32(c.G), bl+uint32(c.B), a+uint32(c.A)
+		}
+		for i := 0; i < length; i++ {
+			x, y := at(i, j)
+			img.SetRGBA64(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(bl / n), uint16(a / n)})
+			out, in := get(i-radius), get(i+radius+1)
+			r += uint32(in.R) - uint32(out.R)
+			g += uint32(in.G) - uint32(out.G)
+			bl += uint32(in.B) - uint32(out.B)
+			a += uint32(in.A) - uint32(out.A)
+		}
+	}
+}
+
+// trimTransparent returns the smallest part of img that contains all of its
+// pixels that aren't fully transparent, or img itself if there are none.
+func trimTransparent(img draw.RGBA64Image) draw.RGBA64Image {
+	b := img.Bounds()
+	r := image.Rectangle{Min: b.Max, Max: b.Min}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if img.RGBA64At(x, y).A != 0 {
+				r.Min.X, r.Max.X = minInt(r.Min.X, x), maxInt(r.Max.X, x+1)
+				r.Min.Y, r.Max.Y = minInt(r.Min.Y, y), maxInt(r.Max.Y, y+1)
+			}
+		}
+	}
+	if r.Empty() {
+		return img
+	}
+	sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	})
+	if !ok {
+		return img
+	}
+	return sub.SubImage(r).(draw.RGBA64Image)
+}
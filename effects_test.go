@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/draw"
+)
+
+// opaqueImage returns a w x h image filled with opaque white.
+func opaqueImage(w, h int) *image.RGBA64 {
+	img := image.NewRGBA64(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA64(x, y, color.RGBA64{0xffff, 0xffff, 0xffff, 0xffff})
+		}
+	}
+	return img
+}
+
+func TestFeatherEdges(t *testing.T) {
+	const width = 8
+	img := opaqueImage(40, 40)
+	featherEdges(img, width)
+	// The alpha ramps up linearly, from 0.5 / width at the edge.
+	ramp := func(d int) uint16 {
+		return uint16(0xffff*(float64(d)+0.5)/width + 0.5)
+	}
+	tests := []struct {
+		d    int
+		want uint16
+	}{
+		{0, ramp(0)},
+		{width / 2, ramp(width / 2)},
+		{width, 0xffff},
+	}
+	center := img.RGBA64At(20, 20).A
+	for _, tt := range tests {
+		for _, p := range []image.Point{{tt.d, 20}, {39 - tt.d, 20}, {20, tt.d}, {20, 39 - tt.d}} {
+			if got := img.RGBA64At(p.X, p.Y).A; got != tt.want {
+				t.Errorf("alpha %d pixels from the edge at %v = %d, want %d", tt.d, p, got, tt.want)
+			}
+		}
+		if tt.d < width && tt.want >= center {
+			t.Errorf("alpha %d pixels from the edge is %d, not below the center's %d", tt.d, tt.want, center)
+		}
+	}
+}
+
+func TestRoundedCoverage(t *testing.T) {
+	const radius = 16
+	r := image.Rect(0, 0, 40, 40)
+	for _, aa := range []int{1, 2, 4, 8} {
+		partial := 0
+		// Walk into the top left corner along its diagonal and along the
+		// top row: coverage must never drop.
+		for _, step := range []image.Point{{1, 1}, {1, 0}} {
+			prev := -1.0
+			for i := 0; i <= radius; i++ {
+				x, y := step.X*i, step.Y*i
+				cov := roundedCoverage(r, radius, x, y, aa)
+				if cov < prev {
+					t.Errorf("aa=%d: coverage at %d, %d is %v, less than the %v before", aa, x, y, cov, prev)
+				}
+				prev = cov
+				if cov > 0 && cov < 1 {
+					partial++
+				}
+				if aa == 1 && cov != 0 && cov != 1 {
+					t.Errorf("aa=1: coverage at %d, %d is %v, want 0 or 1", x, y, cov)
+				}
+			}
+		}
+		if aa > 1 && partial == 0 {
+			t.Errorf("aa=%d: no partially covered pixels along the corner arc", aa)
+		}
+	}
+	if cov := roundedCoverage(r, radius, 20, 20, 4); cov != 1 {
+		t.Errorf("coverage in the center is %v, want 1", cov)
+	}
+	if cov := roundedCoverage(r, radius, 0, 0, 4); cov != 0 {
+		t.Errorf("coverage in the corner is %v, want 0", cov)
+	}
+}
+
+func TestPlaceArtworkBlend(t *testing.T) {
+	gray := color.RGBA64{0x8000, 0x8000, 0x8000, 0xffff}
+	art := image.NewUniform(color.RGBA64{0xffff, 0x4000, 0, 0xffff})
+	tests := []struct {
+		blend string
+		want  color.RGBA64
+	}{
+		{"over", color.RGBA64{0xffff, 0x4000, 0, 0xffff}},
+		{"multiply", color.RGBA64{0x8000, 0x2000, 0, 0xffff}},
+		{"screen", color.RGBA64{0xffff, 0xa000, 0x8000, 0xffff}},
+		{"add", color.RGBA64{0xffff, 0xc000, 0x8000, 0xffff}},
+	}
+	for _, tt := range tests {
+		dst := image.NewRGBA64(image.Rect(0, 0, 20, 20))
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(gray), image.Point{}, draw.Src)
+		opts := &Options{Blend: tt.blend}
+		src := image.NewRGBA64(image.Rect(0, 0, 10, 10))
+		draw.Draw(src, src.Bounds(), art, image.Point{}, draw.Src)
+		r := placeArtwork(opts, dst, src, LayoutOpts{BoxX: 5, BoxY: 5, BoxW: 10, BoxH: 10})
+		if r != image.Rect(5, 5, 15, 15) {
+			t.Fatalf("%s: artwork placed at %v", tt.blend, r)
+		}
+		got := dst.RGBA64At(10, 10)
+		near := func(a, b uint16) bool { return a-b < 0x100 || b-a < 0x100 }
+		if !near(got.R, tt.want.R) || !near(got.G, tt.want.G) || !near(got.B, tt.want.B) || got.A != tt.want.A {
+			t.Errorf("%s: got %v, want %v", tt.blend, got, tt.want)
+		}
+		if outside := dst.RGBA64At(2, 2); outside != gray {
+			t.Errorf("%s: background outside the artwork is %v, want %v", tt.blend, outside, gray)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"sync"
+)
+
+// errWrite wraps errors writing generated images.
+var errWrite = errors.New("Can't write image file")
+
+// Stages of generating an image that errors are attributed to.
+const (
+	stageMatch  = "match"
+	stageSource = "source"
+	stageDecode = "decode"
+	stageRender = "render"
+	stageWrite  = "write"
+	stageBudget = "budget"
+	stageRead   = "read"
+)
+
+// errorStage returns the stage of generating an image an error happened
+// in.
+func errorStage(err error) string {
+	var pngErr png.FormatError
+	var jpegErr jpeg.FormatError
+	var pathErr *os.PathError
+	switch {
+	case errors.Is(err, errNoArtwork):
+		return stageMatch
+	case errors.Is(err, errSourceTooSmall):
+		return stageSource
+	case errors.Is(err, errBudgetExceeded):
+		return stageBudget
+	case errors.Is(err, errWrite):
+		return stageWrite
+	case errors.Is(err, image.ErrFormat), errors.As(err, &pngErr), errors.As(err, &jpegErr):
+		return stageDecode
+	case errors.As(err, &pathErr):
+		return stageRead
+	}
+	return stageRender
+}
+
+// errorEntry is a failure to generate an image.
+type errorEntry struct {
+	Console string `json:"console"`
+	Game    string `json:"game"`
+	Stage   string `json:"stage"`
+	Error   string `json:"error"`
+}
+
+// errorLog collects all failures for --error_json.
+type errorLog struct {
+	path string
+
+	mu      sync.Mutex
+	entries []errorEntry
+}
+
+// record adds the failure err to generate the image of game.
+func (l *errorLog) record(console, game string, err error) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, errorEntry{
+		Console: console,
+		Game:    game,
+		Stage:   errorStage(err),
+		Error:   err.Error(),
+	})
+}
+
+// save writes the failures to the log's file as a JSON array.
+func (l *errorLog) save() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entries := l.entries
+	if entries == nil {
+		entries = []errorEntry{}
+	}
+	return writeJSONFile(nil, l.path, entries)
+}
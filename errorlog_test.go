@@ -0,0 +1,53 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io/fs"
+	"os"
+	"testing"
+)
+
+func TestErrorStage(t *testing.T) {
+	pathErr := &os.PathError{Op: "open", Path: "x.png", Err: fs.ErrNotExist}
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"no artwork", fmt.Errorf("gb/Tetris: %w", errNoArtwork), stageMatch},
+		{"too small", fmt.Errorf("%w: 10x10", errSourceTooSmall), stageSource},
+		{"budget", fmt.Errorf("%w: writing x.png would exceed 100 bytes", errBudgetExceeded), stageBudget},
+		// A write error wraps the *os.PathError of the failed write, which
+		// must not make it a read error.
+		{"write", fmt.Errorf("%w %s: %w", errWrite, "x.png", pathErr), stageWrite},
+		{"unknown format", fmt.Errorf("x.png: %w", image.ErrFormat), stageDecode},
+		{"broken png", png.FormatError("bad header"), stageDecode},
+		{"read", pathErr, stageRead},
+		{"anything else", errors.New("boom"), stageRender},
+	}
+	for _, tt := range tests {
+		if got := errorStage(tt.err); got != tt.want {
+			t.Errorf("%s: errorStage(%v) = %q, want %q", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// realFormat returns the format of the image file path as detected by its
+// contents, normalized like normalizeFormat.
+func realFormat(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	_, format, err := image.DecodeConfig(f)
+	return normalizeFormat(format), err
+}
+
+// verifyExtensions logs the artwork files in the media directories of a
+// console whose extension doesn't match their contents, e.g. JPEGs named
+// .png. With fix, they are renamed to the right extension, unless that
+// file exists already. It returns the number of files left mismatched or
+// that couldn't be decoded.
+func verifyExtensions(opts *Options, folder string, fix bool) int {
+	console := opts.consoleName(folder)
+	opts = opts.forConsole(console)
+	seen := make(map[string]bool)
+	bad := 0
+	for i := range opts.Variants {
+		dir := opts.Variants[i].consoleMediaDir(console, opts.Aliases)
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.IsDir() || !isArtworkFile(e.Name()) {
+				continue
+			}
+			path := filepath.Join(dir, e.Name())
+			format, err := realFormat(path)
+			if err != nil {
+				logger.Printf("Can't decode %s: %s\n", path, err)
+				bad++
+				continue
+			}
+			if format == normalizeFormat(filepath.Ext(e.Name())) {
+				continue
+			}
+			fixed := trimExt(path) + "." + format
+			switch {
+			case !fix:
+				logger.Printf("%s is a %s file\n", path, format)
+			case !isArtworkFile(fixed):
+				logger.Printf("%s is a %s file, which is not supported as artwork\n", path, format)
+			case fileExists(fixed):
+				logger.Printf("%s is a %s file, but can't be renamed: %s exists\n", path, format, fixed)
+			default:
+				if err := os.Rename(path, fixed); err != nil {
+					logger.Printf("%s is a %s file, but can't be renamed: %s\n", path, format, err)
+					break
+				}
+				logger.Printf("Renamed %s to %s\n", path, filepath.Base(fixed))
+				continue
+			}
+			bad++
+		}
+	}
+	return bad
+}
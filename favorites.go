@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// gamelistFileName is the name of an EmulationStation gamelist in a ROM
+// folder.
+const gamelistFileName = "gamelist.xml"
+
+// favorites is a set of "console/game" and plain game names (or ROM file
+// names) marked as favorites.
+type favorites map[string]bool
+
+// loadFavorites reads a list of favorites: either a file with one game per
+// line, optionally prefixed with "console/", or a directory like muOS's
+// info/favourite whose file names are the games.
+func loadFavorites(path string) (favorites, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	favs := make(favorites)
+	if fi.IsDir() {
+		files, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if !f.IsDir() && !isJunkFile(f.Name()) {
+				favs[trimExt(f.Name())] = true
+			}
+		}
+		return favs, nil
+	}
+	lines, err := readListFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range lines {
+		favs[l] = true
+	}
+	return favs, nil
+}
+
+// loadGamelistFavorites returns the games marked as favorites in the
+// gamelist in romDir, if there is one.
+func loadGamelistFavorites(romDir string) (favorites, error) {
+	path := filepath.Join(romDir, gamelistFileName)
+	if !fileExists(path) {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var gl struct {
+		Games []struct {
+			Path     string `xml:"path"`
+			Favorite string `xml:"favorite"`
+		} `xml:"game"`
+	}
+	if err = xml.Unmarshal(data, &gl); err != nil {
+		return nil, err
+	}
+	favs := make(favorites)
+	for _, g := range gl.Games {
+		if strings.EqualFold(strings.TrimSpace(g.Favorite), "true") {
+			favs[filepath.Base(filepath.FromSlash(g.Path))] = true
+		}
+	}
+	return favs, nil
+}
+
+// has reports whether the ROM filename or its game name of console is in
+// the set.
+func (f favorites) has(console, filename, game string) bool {
+	return f[console+"/"+filename] || f[console+"/"+game] || f[filename] || f[game]
+}
+
+// isFavorite reports whether a game is a favorite according to local (the
+// console's gamelist), --favorites, or the --badges file.
+func (opts *Options) isFavorite(local favorites, console, filename, game string) bool {
+	if local.has(console, filename, game) || opts.Favorites.has(console, filename, game) {
+		return true
+	}
+	b, ok := opts.Badges.lookup(console, game)
+	return ok && b.Favorite
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// frontendProfile describes where a frontend expects game images.
+type frontendProfile struct {
+	// ImgDir is the directory inside each console's output directory.
+	ImgDir string
+	// NameTemplate is the output file name without extension, see
+	// outputName.
+	NameTemplate string
+}
+
+// frontends are the layouts supported by --frontend, see README.md.
+var frontends = map[string]frontendProfile{
+	"stock":  {"imgs", "{game}"},
+	"garlic": {"Imgs", "{game}"},
+	"muos":   {"box", "{game}"},
+	"es":     {"images", "{game}-image"},
+}
+
+// outputName returns the file name, without extension, of the image of
+// variant v for a game. The template may contain {game}, {title}, and
+// {console}. With NameHash, the name ends in a hash of console and game.
+func outputName(opts *Options, console, game string, v *Variant) string {
+	title, _ := gameNames(opts, game)
+	name := strings.NewReplacer(
+		"{game}", game,
+		"{title}", cleanTitle(title),
+		"{console}", console,
+	).Replace(opts.NameTemplate)
+	if opts.NameHash > 0 {
+		name += "-" + nameHash(console, game, opts.NameHash)
+	}
+	return name + v.Suffix
+}
+
+// nameHash returns the first n hex digits of the SHA-256 of console and
+// game, which are the same in every run.
+func nameHash(console, game string, n int) string {
+	sum := sha256.Sum256([]byte(console + "/" + game))
+	return hex.EncodeToString(sum[:])[:n]
+}
+
+// shardOther is the shard of names that don't start with a letter.
+const shardOther = "0"
+
+// shardOf returns the directory --shard_by_letter files name under: its
+// first letter in upper case, or shardOther.
+func shardOf(name string) string {
+	for _, r := range name {
+		if r < unicode.MaxASCII && unicode.IsLetter(r) {
+			return string(unicode.ToUpper(r))
+		}
+		break
+	}
+	return shardOther
+}
+
+// isShard reports whether dir is a name shardOf returns.
+func isShard(dir string) bool {
+	return dir == shardOther || len(dir) == 1 && dir[0] >= 'A' && dir[0] <= 'Z'
+}
+
+// shardedName returns name inside its shard with ShardByLetter, or name
+// itself otherwise.
+func (opts *Options) shardedName(name string) string {
+	if !opts.ShardByLetter {
+		return name
+	}
+	return filepath.Join(shardOf(name), name)
+}
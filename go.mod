@@ -2,4 +2,9 @@ module github.com/asig/rg35xx-artgen
 
 go 1.20
 
-require golang.org/x/image v0.13.0
+require (
+	github.com/mattn/go-sqlite3 v1.14.22
+	golang.org/x/image v0.13.0
+)
+
+require golang.org/x/text v0.13.0 // indirect
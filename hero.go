@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"image"
+	"math"
+	"path/filepath"
+
+	"golang.org/x/image/draw"
+)
+
+// coverImage scales img to fill a w x h image completely, keeping its
+// aspect ratio and cropping what sticks out on either side.
+func coverImage(opts *Options, img image.Image, w, h int) draw.RGBA64Image {
+	b := img.Bounds()
+	scale := math.Max(float64(w)/float64(b.Dx()), float64(h)/float64(b.Dy()))
+	cw := minInt(b.Dx(), int(math.Round(float64(w)/scale)))
+	ch := minInt(b.Dy(), int(math.Round(float64(h)/scale)))
+	x := b.Min.X + (b.Dx()-cw)/2
+	y := b.Min.Y + (b.Dy()-ch)/2
+	crop := image.Rect(x, y, x+cw, y+ch)
+	dst := opts.newImage(image.Rect(0, 0, w, h))
+	opts.scalerFor(cw, ch, w, h).Scale(dst, dst.Bounds(), img, crop, draw.Src, nil)
+	return dst
+}
+
+// heroDir returns the directory the hero images for console are written to.
+func heroDir(opts *Options, console string) string {
+	root := opts.RomDir
+	if len(opts.OutputRoot) > 0 {
+		root = opts.OutputRoot
+	}
+	return filepath.Join(root, console, opts.HeroDir)
+}
+
+// genHero writes a full screen image of a game's artwork, cropped to fill
+// the canvas and optionally blurred and darkened, to dir. It returns the
+// file written, or "" if it was skipped.
+func genHero(opts *Options, mediaDir, dir, console, game string) (string, error) {
+	targetName := filepath.Join(dir, outputName(opts, console, game, &Variant{})+opts.Format.Ext)
+	if opts.SkipExisting && fileExists(targetName) {
+		return "", nil
+	}
+	artwork, src, err := findGameArtwork(opts, mediaDir, console, game)
+	if err != nil {
+		return "", err
+	}
+	img := coverImage(opts, artwork, opts.CanvasW, opts.CanvasH)
+	blurImage(img, opts.HeroBlur)
+	if opts.HeroDarken > 0 {
+		b := img.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				img.SetRGBA64(x, y, scaleColor(img.RGBA64At(x, y), 1-opts.HeroDarken, false))
+			}
+		}
+	}
+
+	out := finishImage(opts, img)
+	if err := opts.writeImage(targetName, out, opts.imageEncoder([]string{src})); err != nil {
+		return "", err
+	}
+	if opts.PostCmd != nil {
+		if err := runPostCmd(opts.PostCmd, targetName); err != nil {
+			logger.Printf("Post-processing %s failed: %s\n", targetName, err)
+		}
+	}
+	return targetName, nil
+}
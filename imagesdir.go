@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// genFromImagesDir composes every image in dir like genImage does with a
+// game's artwork, and writes the results to outDir, named after the images.
+// No ROMs are needed, and no artwork is matched. It returns the number of
+// images that could not be generated.
+func genFromImagesDir(opts *Options, dir, outDir string) (int, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := mkdirAll(outDir); err != nil {
+		return 0, err
+	}
+	console := filepath.Base(dir)
+	v := &opts.Variants[0]
+	o := opts.forVariant(v)
+	failed := 0
+	for _, e := range entries {
+		if e.IsDir() || !isArtworkFile(e.Name()) {
+			continue
+		}
+		name := strings.TrimSuffix(e.Name(), filepath.Ext(e.Name()))
+		if opts.Games != nil && !opts.Games.match(e.Name(), name) {
+			continue
+		}
+		src := filepath.Join(dir, e.Name())
+		targetName := filepath.Join(outDir, name+o.Format.Ext)
+		if err := genFromImage(o, v, src, targetName, console, name); err != nil {
+			o.report(console, name, StatusFailed, err)
+			failed++
+			continue
+		}
+		logger.Printf("Created image %s\n", targetName)
+	}
+	return failed, nil
+}
+
+// genFromImage composes the image src and writes it to targetName.
+func genFromImage(opts *Options, v *Variant, src, targetName, console, name string) error {
+	artwork, err := loadImageFile(src)
+	if err != nil {
+		return fmt.Errorf("Can't load %s: %w", src, err)
+	}
+	img, err := decorateImage(opts, composeArtwork(opts, v, artwork, console, name), console, name)
+	if err != nil {
+		return err
+	}
+	img = finishImage(opts, img)
+	if err := opts.writeImage(targetName, img, opts.imageEncoder([]string{src})); err != nil {
+		return err
+	}
+	return nil
+}
+
+// isArtworkFile reports whether filename has one of the artwork extensions.
+func isArtworkFile(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, e := range artworkExts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
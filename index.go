@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"image"
+	"io/ioutil"
+	"os"
+)
+
+// indexEntry describes one generated image in a console's index file.
+type indexEntry struct {
+	Game   string `json:"game"`
+	Image  string `json:"image"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// indexFileName returns the name of the index file for console, relative
+// to the console's output directory.
+func indexFileName(console string) string {
+	return console + ".json"
+}
+
+// newIndexEntry describes the image at path, generated for game. name is
+// its name relative to the console's output directory.
+func newIndexEntry(game, name, path string) (indexEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return indexEntry{}, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return indexEntry{}, err
+	}
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return indexEntry{}, err
+	}
+	return indexEntry{
+		Game:   game,
+		Image:  name,
+		Width:  cfg.Width,
+		Height: cfg.Height,
+		Bytes:  fi.Size(),
+	}, nil
+}
+
+// writeIndex writes entries as JSON to path, replacing it atomically,
+// within budget b.
+func writeIndex(b *outputBudget, path string, entries []indexEntry) error {
+	if entries == nil {
+		entries = []indexEntry{}
+	}
+	return writeJSONFile(b, path, entries)
+}
+
+// writeJSONFile writes v as indented JSON to path, replacing it atomically,
+// within budget b.
+func writeJSONFile(b *outputBudget, path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return b.write(path, int64(len(data)), func() error {
+		tmp := path + ".tmp"
+		if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+			return err
+		}
+		return os.Rename(tmp, path)
+	})
+}
@@ -0,0 +1,236 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// Layer is one step of a layered composition, see --layers. Layers are
+// rendered in order onto the canvas.
+type Layer struct {
+	// Type is one of "art" (the game's artwork), "file" (a static image),
+	// "color" (a solid fill), or "text".
+	Type string `json:"type"`
+	// MediaDir is the media root for "art" layers, relative to --rom_dir.
+	// Defaults to the media dir of the variant being generated.
+	MediaDir string `json:"media_dir"`
+	// Path is the image of a "file" layer, relative to the layer config.
+	Path string `json:"path"`
+	// Color is used by "color" and "text" layers.
+	Color string `json:"color"`
+	// Text is rendered by "text" layers; {title}, {game}, and {console}
+	// are replaced.
+	Text string  `json:"text"`
+	Size float64 `json:"size"`
+	// Rect is the placement as WxH+X+Y. Defaults to the variant's box for
+	// "art" layers and to the whole canvas otherwise.
+	Rect string `json:"rect"`
+	// Fit is "contain" (keep aspect ratio, the default) or "stretch".
+	Fit string `json:"fit"`
+	// Blend is how the layer is combined with what is below it: "over"
+	// (the default), "replace", or one of the blend modes "multiply",
+	// "screen", and "add".
+	Blend string `json:"blend"`
+	// Optional "art" layers are left out if there is no artwork rather
+	// than failing the image.
+	Optional bool `json:"optional"`
+
+	rect    *LayoutOpts
+	img     image.Image
+	color   color.Color
+	stretch bool
+}
+
+type layerConfig struct {
+	Layers []*Layer `json:"layers"`
+}
+
+// loadLayers reads and validates a layer config.
+func loadLayers(path, romDir string) ([]*Layer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg layerConfig
+	if err = json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	if len(cfg.Layers) == 0 {
+		return nil, fmt.Errorf("%s: no layers", path)
+	}
+	for i, l := range cfg.Layers {
+		if err = l.init(filepath.Dir(path), romDir); err != nil {
+			return nil, fmt.Errorf("%s: layer %d: %s", path, i+1, err)
+		}
+	}
+	return cfg.Layers, nil
+}
+
+func (l *Layer) init(configDir, romDir string) error {
+	if len(l.Rect) > 0 {
+		r, err := parseBox(l.Rect)
+		if err != nil {
+			return err
+		}
+		l.rect = &r
+	}
+	switch l.Fit {
+	case "", "contain":
+	case "stretch":
+		l.stretch = true
+	default:
+		return fmt.Errorf("unknown fit %q", l.Fit)
+	}
+	if _, ok := blendFuncs[l.Blend]; !ok {
+		switch l.Blend {
+		case "", "over", "replace":
+		default:
+			return fmt.Errorf("unknown blend %q", l.Blend)
+		}
+	}
+
+	l.color = color.White
+	if len(l.Color) > 0 {
+		c, err := parseColor(l.Color)
+		if err != nil {
+			return err
+		}
+		l.color = c
+	}
+
+	switch l.Type {
+	case "art":
+		if len(l.MediaDir) > 0 {
+			l.MediaDir = filepath.Join(romDir, l.MediaDir)
+		}
+	case "file":
+		path := l.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(configDir, path)
+		}
+		img, err := loadImageFile(path)
+		if err != nil {
+			return err
+		}
+		l.img = img
+	case "color":
+		if len(l.Color) == 0 {
+			return fmt.Errorf("color layers need a color")
+		}
+	case "text":
+		if l.Size <= 0 {
+			l.Size = 24
+		}
+	default:
+		return fmt.Errorf("unknown type %q", l.Type)
+	}
+	return nil
+}
+
+// box returns where the layer is placed.
+func (l *Layer) box(opts *Options, v *Variant) LayoutOpts {
+	if l.rect != nil {
+		return *l.rect
+	}
+	if l.Type == "art" {
+		return v.Layout
+	}
+	return LayoutOpts{0, 0, opts.CanvasW, opts.CanvasH}
+}
+
+// drawImage draws img into box, honoring the layer's fit.
+func (l *Layer) drawImage(opts *Options, dst draw.RGBA64Image, img image.Image, box LayoutOpts) image.Rectangle {
+	if !l.stretch {
+		return placeArtwork(opts, dst, img, box)
+	}
+	r := boxRect(box)
+	b := img.Bounds()
+	opts.scalerFor(b.Dx(), b.Dy(), r.Dx(), r.Dy()).Scale(dst, r, img, b, draw.Over, nil)
+	return r
+}
+
+// renderLayers renders the image for a game from the configured layers. It
+// returns the image and the files it was rendered from.
+func renderLayers(opts *Options, v *Variant, mediaDir, console, game string) (draw.RGBA64Image, []string, error) {
+	img := newCanvas(opts)
+	var sources []string
+	for _, l := range opts.Layers {
+		box := l.box(opts, v)
+		layer := opts.newImage(img.Bounds())
+		r := boxRect(box)
+		switch l.Type {
+		case "art":
+			dir := mediaDir
+			if len(l.MediaDir) > 0 {
+				dir = (&Variant{MediaDir: l.MediaDir}).consoleMediaDir(console, opts.Aliases)
+			}
+			var artwork image.Image
+			var src string
+			var err error
+			if l.Optional {
+				if artwork, src, err = findGameArtwork(opts, dir, console, game); err != nil {
+					continue
+				}
+			} else if artwork, src, err = loadGameArtwork(opts, dir, console, game, box.BoxW, box.BoxH); err != nil {
+				return nil, nil, err
+			}
+			if len(src) > 0 {
+				sources = append(sources, src)
+			}
+			r = l.drawImage(opts, layer, artwork, box)
+			opts.LayoutReport.record(console, game, v, artwork.Bounds(), r)
+			if opts.BorderWidth > 0 && !opts.BorderAroundBox {
+				drawBorder(layer, r, opts.BorderWidth, opts.BorderColor)
+			}
+			r = r.Inset(-opts.BorderWidth)
+		case "file":
+			r = l.drawImage(opts, layer, l.img, box)
+		case "color":
+			draw.Draw(layer, r, image.NewUniform(l.color), image.Point{}, draw.Src)
+		case "text":
+			title, _ := gameNames(opts, game)
+			text := strings.NewReplacer("{title}", cleanTitle(title), "{game}", game, "{console}", console).Replace(l.Text)
+			if err := drawText(layer, r, text, l.Size, l.color); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		r = r.Intersect(img.Bounds())
+		switch l.Blend {
+		case "", "over":
+			draw.Draw(img, r, layer, r.Min, draw.Over)
+		case "replace":
+			draw.Draw(img, r, layer, r.Min, draw.Src)
+		default:
+			blendImage(img, layer, r, l.Blend)
+		}
+	}
+	if opts.BorderWidth > 0 && opts.BorderAroundBox {
+		drawBorder(img, boxRect(v.Layout), opts.BorderWidth, opts.BorderColor)
+	}
+	return img, sources, nil
+}
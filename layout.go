@@ -0,0 +1,324 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// LayoutOpts describes the box artwork is fit into.
+type LayoutOpts struct {
+	BoxX, BoxY int
+	BoxW, BoxH int
+}
+
+// defaultLayout is the artwork box shown in the diagram in rg35xx-artgen.go.
+var defaultLayout = LayoutOpts{
+	BoxX: artworkX,
+	BoxY: artworkY,
+	BoxW: artworkMaxW,
+	BoxH: artworkMaxH,
+}
+
+// computeLayout fits an image of srcW x srcH pixels into the box described
+// by opts, keeping its aspect ratio, and centers it in the box. It returns
+// the scaled size and the position of the scaled image's top left corner.
+// The limiting side always spans the box exactly; the other one is rounded
+// to the nearest pixel.
+func computeLayout(srcW, srcH int, opts LayoutOpts) (w, h, posX, posY int) {
+	if srcW*opts.BoxH >= srcH*opts.BoxW {
+		// Width-limited
+		w = opts.BoxW
+		h = maxInt(1, minInt(opts.BoxH, int(math.Round(float64(opts.BoxW)*float64(srcH)/float64(srcW)))))
+	} else {
+		h = opts.BoxH
+		w = maxInt(1, minInt(opts.BoxW, int(math.Round(float64(opts.BoxH)*float64(srcW)/float64(srcH)))))
+	}
+	posX = opts.BoxX + int(math.Round(float64(opts.BoxW-w)/2))
+	posY = opts.BoxY + int(math.Round(float64(opts.BoxH-h)/2))
+	return w, h, posX, posY
+}
+
+// fitLayout is computeLayout, except that a scaled side at most FillSnap
+// pixels short of the box is stretched to span it, too. Otherwise, art with
+// almost the box's aspect ratio would leave a seam of a pixel or so that
+// stands out against solid and gradient backgrounds.
+func (opts *Options) fitLayout(srcW, srcH int, box LayoutOpts) (w, h, posX, posY int) {
+	w, h, posX, posY = computeLayout(srcW, srcH, box)
+	if w < box.BoxW && box.BoxW-w <= opts.FillSnap {
+		w, posX = box.BoxW, box.BoxX
+	}
+	if h < box.BoxH && box.BoxH-h <= opts.FillSnap {
+		h, posY = box.BoxH, box.BoxY
+	}
+	return w, h, posX, posY
+}
+
+// screenAnchors are the positions --screen_anchor places artwork at.
+var screenAnchors = []string{"top_left", "top", "top_right", "left", "center", "right", "bottom_left", "bottom", "bottom_right"}
+
+// isScreenAnchor reports whether s is one of screenAnchors.
+func isScreenAnchor(s string) bool {
+	for _, a := range screenAnchors {
+		if s == a {
+			return true
+		}
+	}
+	return false
+}
+
+// anchorPos returns the top left corner of a w x h rectangle placed in r
+// at anchor.
+func anchorPos(anchor string, w, h int, r image.Rectangle) (int, int) {
+	x := r.Min.X + int(math.Round(float64(r.Dx()-w)/2))
+	y := r.Min.Y + int(math.Round(float64(r.Dy()-h)/2))
+	switch {
+	case strings.HasSuffix(anchor, "left"):
+		x = r.Min.X
+	case strings.HasSuffix(anchor, "right"):
+		x = r.Max.X - w
+	}
+	switch {
+	case strings.HasPrefix(anchor, "top"):
+		y = r.Min.Y
+	case strings.HasPrefix(anchor, "bottom"):
+		y = r.Max.Y - h
+	}
+	return x, y
+}
+
+// anchored returns a box of the size of o, shrunk to fit if necessary,
+// placed at anchor on a w x h canvas, margin pixels away from its edges.
+func (o LayoutOpts) anchored(anchor string, margin, w, h int) LayoutOpts {
+	area := image.Rect(margin, margin, w-margin, h-margin)
+	bw, bh := minInt(o.BoxW, area.Dx()), minInt(o.BoxH, area.Dy())
+	x, y := anchorPos(anchor, bw, bh, area)
+	return LayoutOpts{BoxX: x, BoxY: y, BoxW: bw, BoxH: bh}
+}
+
+// withHeight returns the box shrunk to at most h pixels high, centered
+// vertically in the original box.
+func (o LayoutOpts) withHeight(h int) LayoutOpts {
+	if h >= o.BoxH {
+		return o
+	}
+	o.BoxY += (o.BoxH - h) / 2
+	o.BoxH = h
+	return o
+}
+
+func (o LayoutOpts) String() string {
+	return fmt.Sprintf("%dx%d+%d+%d", o.BoxW, o.BoxH, o.BoxX, o.BoxY)
+}
+
+// boxRect returns the box described by o as a rectangle.
+func boxRect(o LayoutOpts) image.Rectangle {
+	return image.Rect(o.BoxX, o.BoxY, o.BoxX+o.BoxW, o.BoxY+o.BoxH)
+}
+
+// scaled returns the box scaled by sx horizontally and sy vertically.
+func (o LayoutOpts) scaled(sx, sy float64) LayoutOpts {
+	return LayoutOpts{
+		BoxX: int(math.Round(float64(o.BoxX) * sx)),
+		BoxY: int(math.Round(float64(o.BoxY) * sy)),
+		BoxW: int(math.Round(float64(o.BoxW) * sx)),
+		BoxH: int(math.Round(float64(o.BoxH) * sy)),
+	}
+}
+
+// insets are the widths of the margins at the edges of the canvas, in
+// pixels.
+type insets struct {
+	Top, Right, Bottom, Left int
+}
+
+// parseInsets parses insets given as one number for all edges, or as four
+// comma-separated numbers for the top, right, bottom, and left edge.
+func parseInsets(s string) (insets, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 1 && len(parts) != 4 {
+		return insets{}, errors.New("expected N or TOP,RIGHT,BOTTOM,LEFT")
+	}
+	var v [4]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || n < 0 {
+			return insets{}, errors.New("expected N or TOP,RIGHT,BOTTOM,LEFT with non-negative numbers")
+		}
+		v[i] = n
+	}
+	if len(parts) == 1 {
+		v = [4]int{v[0], v[0], v[0], v[0]}
+	}
+	return insets{v[0], v[1], v[2], v[3]}, nil
+}
+
+// safeRect returns the part of the canvas inside the SafeInset margins.
+func (opts *Options) safeRect() image.Rectangle {
+	i := opts.SafeInset
+	return image.Rect(i.Left, i.Top, opts.CanvasW-i.Right, opts.CanvasH-i.Bottom)
+}
+
+// safeBox returns the part of box inside the SafeInset margins, or box
+// itself if it lies completely outside of them.
+func (opts *Options) safeBox(box LayoutOpts) LayoutOpts {
+	r := boxRect(box).Intersect(opts.safeRect())
+	if r.Empty() {
+		return box
+	}
+	return LayoutOpts{BoxX: r.Min.X, BoxY: r.Min.Y, BoxW: r.Dx(), BoxH: r.Dy()}
+}
+
+// parseAspect parses an aspect ratio given as "W:H" or as a number.
+func parseAspect(s string) (float64, error) {
+	var aspect float64
+	var err error
+	if w, h, ok := strings.Cut(s, ":"); ok {
+		var fw, fh float64
+		if fw, err = strconv.ParseFloat(w, 64); err == nil {
+			if fh, err = strconv.ParseFloat(h, 64); err == nil && fh != 0 {
+				aspect = fw / fh
+			}
+		}
+	} else {
+		aspect, err = strconv.ParseFloat(s, 64)
+	}
+	if err != nil || aspect <= 0 || math.IsInf(aspect, 0) {
+		return 0, errors.New("expected W:H or a positive number")
+	}
+	return aspect, nil
+}
+
+// parseSize parses an image size given as "WxH".
+func parseSize(s string) (int, int, error) {
+	w, h, ok := strings.Cut(s, "x")
+	if ok {
+		var err error
+		var iw, ih int
+		if iw, err = strconv.Atoi(w); err == nil {
+			if ih, err = strconv.Atoi(h); err == nil && iw > 0 && ih > 0 {
+				return iw, ih, nil
+			}
+		}
+	}
+	return 0, 0, errors.New("expected WxH with positive numbers")
+}
+
+// canvasSize is the size of generated images.
+type canvasSize struct {
+	W, H int
+}
+
+func (s canvasSize) String() string {
+	return fmt.Sprintf("%dx%d", s.W, s.H)
+}
+
+// crop is a named size artwork is cover-cropped to, for --crops.
+type crop struct {
+	Name string
+	canvasSize
+}
+
+// parseCrops parses a comma-separated list of crops given as "name:WxH".
+func parseCrops(s string) ([]crop, error) {
+	var crops []crop
+	seen := make(map[string]bool)
+	for _, c := range strings.Split(s, ",") {
+		name, size, ok := strings.Cut(strings.TrimSpace(c), ":")
+		if !ok || len(name) == 0 || strings.ContainsAny(name, `/\`) {
+			return nil, fmt.Errorf("%q: expected name:WxH", c)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("crop %q given twice", name)
+		}
+		seen[name] = true
+		w, h, err := parseSize(size)
+		if err != nil {
+			return nil, fmt.Errorf("crop %s: %w", name, err)
+		}
+		crops = append(crops, crop{name, canvasSize{w, h}})
+	}
+	return crops, nil
+}
+
+// outputSet is one set of images generated per game, at one size.
+type outputSet struct {
+	opts *Options
+	// subdir is the set's directory inside each console's output
+	// directory.
+	subdir string
+}
+
+// outputSets returns opts itself if neither Sizes nor Crops are set, and
+// otherwise one set per size, with the variants' boxes scaled to it, or one
+// per crop, with the artwork covering the whole image.
+func (opts *Options) outputSets() []outputSet {
+	if len(opts.Crops) > 0 {
+		return opts.cropSets()
+	}
+	if len(opts.Sizes) == 0 {
+		return []outputSet{{opts: opts}}
+	}
+	var sets []outputSet
+	for _, size := range opts.Sizes {
+		o := *opts
+		o.CanvasW, o.CanvasH = size.W, size.H
+		sx := float64(size.W) / float64(opts.CanvasW)
+		sy := float64(size.H) / float64(opts.CanvasH)
+		o.Variants = make([]Variant, len(opts.Variants))
+		for i, v := range opts.Variants {
+			v.Layout = v.Layout.scaled(sx, sy)
+			o.Variants[i] = v
+		}
+		sets = append(sets, outputSet{opts: &o, subdir: size.String()})
+	}
+	return sets
+}
+
+// cropSets returns one set per crop. All of them are generated from the
+// same decoded artwork, which is scaled to cover the whole image and
+// cropped to it.
+func (opts *Options) cropSets() []outputSet {
+	var sets []outputSet
+	for _, c := range opts.Crops {
+		o := *opts
+		o.CanvasW, o.CanvasH = c.W, c.H
+		o.Fit = "cover"
+		o.UniformHeight = 0
+		o.Variants = make([]Variant, len(opts.Variants))
+		for i, v := range opts.Variants {
+			v.Layout = LayoutOpts{BoxW: c.W, BoxH: c.H}
+			o.Variants[i] = v
+		}
+		sets = append(sets, outputSet{opts: &o, subdir: c.Name})
+	}
+	return sets
+}
+
+// centeredLayout returns a box centered on a w x h canvas that spans the
+// fraction max of it in both directions.
+func centeredLayout(w, h int, max float64) LayoutOpts {
+	bw := int(math.Round(float64(w) * max))
+	bh := int(math.Round(float64(h) * max))
+	return LayoutOpts{BoxX: (w - bw) / 2, BoxY: (h - bh) / 2, BoxW: bw, BoxH: bh}
+}
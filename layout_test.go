@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import "testing"
+
+func TestComputeLayout(t *testing.T) {
+	box := LayoutOpts{BoxX: 15, BoxY: 65, BoxW: 320, BoxH: 350}
+	tests := []struct {
+		name             string
+		srcW, srcH       int
+		w, h, posX, posY int
+	}{
+		{"landscape", 200, 100, 320, 160, 15, 160},
+		{"portrait", 100, 300, 117, 350, 117, 65},
+		{"square", 100, 100, 320, 320, 15, 80},
+		{"tiny landscape", 1000, 1, 320, 1, 15, 240},
+		// Sources with the box's aspect ratio fill it exactly.
+		{"box aspect", 640, 700, 320, 350, 15, 65},
+		{"box size", 320, 350, 320, 350, 15, 65},
+		// 320 * 351 / 321 is 349.9, which truncating left a 1 pixel gap.
+		{"almost box aspect", 321, 351, 320, 350, 15, 65},
+	}
+	for _, tt := range tests {
+		w, h, posX, posY := computeLayout(tt.srcW, tt.srcH, box)
+		if w != tt.w || h != tt.h || posX != tt.posX || posY != tt.posY {
+			t.Errorf("%s: computeLayout(%d, %d) = %d, %d, %d, %d; want %d, %d, %d, %d",
+				tt.name, tt.srcW, tt.srcH, w, h, posX, posY, tt.w, tt.h, tt.posX, tt.posY)
+		}
+	}
+}
+
+func TestFitLayoutSnap(t *testing.T) {
+	box := LayoutOpts{BoxX: 15, BoxY: 65, BoxW: 320, BoxH: 350}
+	tests := []struct {
+		name             string
+		snap             int
+		srcW, srcH       int
+		w, h, posX, posY int
+	}{
+		{"disabled", 0, 321, 350, 320, 349, 15, 66},
+		{"1px short", 1, 321, 350, 320, 350, 15, 65},
+		{"2px short, snap 1", 1, 320, 348, 320, 348, 15, 66},
+		{"2px short, snap 2", 2, 320, 348, 320, 350, 15, 65},
+		{"narrow 1px short", 1, 321, 352, 320, 350, 15, 65},
+		{"far off is kept", 1, 200, 100, 320, 160, 15, 160},
+	}
+	for _, tt := range tests {
+		opts := &Options{FillSnap: tt.snap}
+		w, h, posX, posY := opts.fitLayout(tt.srcW, tt.srcH, box)
+		if w != tt.w || h != tt.h || posX != tt.posX || posY != tt.posY {
+			t.Errorf("%s: fitLayout(%d, %d) = %d, %d, %d, %d; want %d, %d, %d, %d",
+				tt.name, tt.srcW, tt.srcH, w, h, posX, posY, tt.w, tt.h, tt.posX, tt.posY)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// layoutEntry is where the artwork of a game ended up.
+type layoutEntry struct {
+	Console string `json:"console"`
+	Game    string `json:"game"`
+	Suffix  string `json:"suffix"`
+	SrcW    int    `json:"src_w"`
+	SrcH    int    `json:"src_h"`
+	ScaledW int    `json:"scaled_w"`
+	ScaledH int    `json:"scaled_h"`
+	PosX    int    `json:"pos_x"`
+	PosY    int    `json:"pos_y"`
+}
+
+// layoutReport collects the layout of every image for --layout_report.
+type layoutReport struct {
+	path string
+
+	mu      sync.Mutex
+	entries []layoutEntry
+}
+
+// record adds the layout of artwork with bounds src, drawn into r, for a
+// variant of a game.
+func (l *layoutReport) record(console, game string, v *Variant, src, r image.Rectangle) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, layoutEntry{
+		Console: console,
+		Game:    game,
+		Suffix:  v.Suffix,
+		SrcW:    src.Dx(),
+		SrcH:    src.Dy(),
+		ScaledW: r.Dx(),
+		ScaledH: r.Dy(),
+		PosX:    r.Min.X,
+		PosY:    r.Min.Y,
+	})
+}
+
+// save writes the report to its file: JSON if its name ends in .json, and
+// CSV otherwise.
+func (l *layoutReport) save() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if strings.EqualFold(filepath.Ext(l.path), ".json") {
+		entries := l.entries
+		if entries == nil {
+			entries = []layoutEntry{}
+		}
+		return writeJSONFile(nil, l.path, entries)
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"console", "game", "suffix", "src_w", "src_h", "scaled_w", "scaled_h", "pos_x", "pos_y"})
+	for _, e := range l.entries {
+		rec := []string{e.Console, e.Game, e.Suffix}
+		for _, n := range []int{e.SrcW, e.SrcH, e.ScaledW, e.ScaledH, e.PosX, e.PosY} {
+			rec = append(rec, strconv.Itoa(n))
+		}
+		w.Write(rec)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	tmp := l.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
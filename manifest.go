@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// artManifest maps games to their artwork, for self-contained art packs. It
+// is read from a JSON file of the form
+//
+//	{"gb": {"Tetris": "gb/Tetris.png", "Zelda": "data:image/png;base64,..."}}
+//
+// Entries are either paths, relative ones resolved against the manifest's
+// directory, or data URIs with base64 encoded image data.
+type artManifest struct {
+	path    string
+	entries map[string]map[string]string
+}
+
+func loadArtManifest(path string) (*artManifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &artManifest{path: path}
+	if err := json.Unmarshal(data, &m.entries); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// lookup returns the manifest's entry for a game, or "" if there is none.
+func (m *artManifest) lookup(console, game string) string {
+	return m.entries[console][game]
+}
+
+// resolve returns the path of a path entry.
+func (m *artManifest) resolve(entry string) string {
+	if filepath.IsAbs(entry) {
+		return entry
+	}
+	return filepath.Join(filepath.Dir(m.path), entry)
+}
+
+// load decodes the artwork of an entry. It returns the image and the file
+// it was loaded from, which is the manifest itself for inline data.
+func (m *artManifest) load(entry string) (image.Image, string, error) {
+	if !strings.HasPrefix(entry, "data:") {
+		path := m.resolve(entry)
+		img, err := loadImageFile(path)
+		return img, path, err
+	}
+	img, err := decodeDataURI(entry)
+	if err != nil {
+		return nil, "", fmt.Errorf("Can't decode inline artwork in %s: %w", m.path, err)
+	}
+	return img, m.path, nil
+}
+
+// decodeDataURI decodes an image given as "data:[<media type>];base64,<data>".
+// The media type is ignored; image.Decode detects the format.
+func decodeDataURI(uri string) (image.Image, error) {
+	header, data, ok := strings.Cut(strings.TrimPrefix(uri, "data:"), ",")
+	if !ok || !strings.HasSuffix(header, ";base64") {
+		return nil, errors.New("expected data:<media type>;base64,<data>")
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	return img, err
+}
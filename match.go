@@ -0,0 +1,248 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// regionTagRegexp matches parenthesized tags like "(USA, Europe)".
+var regionTagRegexp = regexp.MustCompile(`\(([^)]*)\)`)
+
+// Match tiers, tried in this order to find a game's artwork.
+const (
+	// matchExact looks for artwork named exactly like the game.
+	matchExact = "exact"
+	// matchTitle compares names with everything in parentheses and
+	// brackets removed, e.g. "Chrono Trigger (USA)" matches
+	// "Chrono Trigger.png".
+	matchTitle = "title"
+)
+
+var matchTierNames = []string{matchExact, matchTitle}
+
+// Policies for picking among several files that match a game by title
+// equally well.
+const (
+	ambiguousFirst   = "first"
+	ambiguousLargest = "largest"
+	ambiguousNewest  = "newest"
+	// ambiguousSkip uses none of them and warns about the game instead.
+	ambiguousSkip = "skip"
+)
+
+var ambiguousPolicies = []string{ambiguousFirst, ambiguousLargest, ambiguousNewest, ambiguousSkip}
+
+// parseMatchTiers parses a comma-separated list of match tiers.
+func parseMatchTiers(s string) (map[string]bool, error) {
+	tiers := make(map[string]bool)
+	for _, t := range strings.Split(s, ",") {
+		t = strings.TrimSpace(t)
+		found := false
+		for _, name := range matchTierNames {
+			found = found || t == name
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown match tier %q, expected one of %s", t, strings.Join(matchTierNames, ", "))
+		}
+		tiers[t] = true
+	}
+	return tiers, nil
+}
+
+// titleKey returns name without any parenthesized or bracketed parts, with
+// runs of spaces collapsed and in lower case.
+func titleKey(name string) string {
+	var b strings.Builder
+	depth := 0
+	for _, r := range name {
+		switch r {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			if depth > 0 {
+				depth--
+			}
+		default:
+			if depth == 0 {
+				b.WriteRune(r)
+			}
+		}
+	}
+	return strings.ToLower(strings.Join(strings.Fields(b.String()), " "))
+}
+
+// titleIndex maps the title keys of the artwork files in media directories
+// to the files. Directories are read once.
+type titleIndex struct {
+	mu   sync.Mutex
+	dirs map[string]map[string][]string
+}
+
+func newTitleIndex() *titleIndex {
+	return &titleIndex{dirs: make(map[string]map[string][]string)}
+}
+
+// lookup returns the artwork files in dir with the same title key as name,
+// in directory order.
+func (t *titleIndex) lookup(dir, name string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	keys, ok := t.dirs[dir]
+	if !ok {
+		keys = make(map[string][]string)
+		entries, _ := ioutil.ReadDir(dir)
+		for _, e := range entries {
+			ext := strings.ToLower(filepath.Ext(e.Name()))
+			for _, artExt := range artworkExts {
+				if !e.IsDir() && ext == artExt {
+					k := titleKey(trimExt(e.Name()))
+					keys[k] = append(keys[k], e.Name())
+					break
+				}
+			}
+		}
+		t.dirs[dir] = keys
+	}
+	return keys[titleKey(name)]
+}
+
+// regionRank returns the index in priority of the first region named in
+// the tags of filename, or len(priority) if it names none of them.
+func regionRank(filename string, priority []string) int {
+	rank := len(priority)
+	for _, m := range regionTagRegexp.FindAllStringSubmatch(trimExt(filename), -1) {
+		for _, region := range strings.Split(m[1], ",") {
+			region = strings.TrimSpace(region)
+			for i, p := range priority[:rank] {
+				if strings.EqualFold(region, p) {
+					rank = i
+					break
+				}
+			}
+		}
+	}
+	return rank
+}
+
+// preferRegions returns the files of the best ranked region in priority,
+// or all files if none names any of them.
+func preferRegions(files, priority []string) []string {
+	if len(priority) == 0 || len(files) < 2 {
+		return files
+	}
+	best := len(priority)
+	var res []string
+	for _, f := range files {
+		switch rank := regionRank(f, priority); {
+		case rank < best:
+			best, res = rank, []string{f}
+		case rank == best:
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// findTitleArtwork returns the artwork in mediaDir that matches any of
+// names by title key. With RegionPriority, only the artwork of the most
+// preferred region is considered; if that still leaves several files,
+// OnAmbiguous picks one of them.
+func (opts *Options) findTitleArtwork(mediaDir string, names []string) (image.Image, string, error) {
+	for _, name := range names {
+		if files := opts.titles.lookup(mediaDir, name); len(files) > 0 {
+			path, err := opts.pickAmbiguous(mediaDir, name, preferRegions(files, opts.RegionPriority))
+			if err != nil {
+				return nil, "", err
+			}
+			img, err := loadImageFile(path)
+			return img, path, err
+		}
+	}
+	return nil, "", errNoArtwork
+}
+
+// pickAmbiguous returns the path of the one of files in mediaDir that
+// OnAmbiguous picks, or PreferLargest if OnAmbiguous is "first". With
+// ambiguousSkip, several files are an error.
+func (opts *Options) pickAmbiguous(mediaDir, name string, files []string) (string, error) {
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = filepath.Join(mediaDir, f)
+	}
+	if len(paths) == 1 {
+		return paths[0], nil
+	}
+	policy := opts.OnAmbiguous
+	if policy == ambiguousFirst && opts.PreferLargest {
+		policy = ambiguousLargest
+	}
+	path := paths[0]
+	switch policy {
+	case ambiguousSkip:
+		logger.Printf("Skipping %s: %d files match it equally well: %s\n", name, len(files), strings.Join(files, ", "))
+		return "", fmt.Errorf("%w: %d files match %s equally well", errNoArtwork, len(files), name)
+	case ambiguousLargest:
+		if p := largestImageFile(paths); len(p) > 0 {
+			path = p
+		}
+	case ambiguousNewest:
+		if p := newestFile(paths); len(p) > 0 {
+			path = p
+		}
+	}
+	if opts.Verbose {
+		logger.Printf("%d files match %s equally well, picked %s (%s)\n", len(files), name, path, policy)
+	}
+	return path, nil
+}
+
+// newestFile returns the most recently modified of paths, or "" if none of
+// them exists.
+func newestFile(paths []string) string {
+	best := ""
+	var bestTime time.Time
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if len(best) == 0 || fi.ModTime().After(bestTime) {
+			best, bestTime = path, fi.ModTime()
+		}
+	}
+	return best
+}
+
+// isAmbiguousPolicy reports whether s is one of ambiguousPolicies.
+func isAmbiguousPolicy(s string) bool {
+	for _, p := range ambiguousPolicies {
+		if s == p {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// nameRuleSeparator separates the pattern of a name rule from its
+// replacement.
+const nameRuleSeparator = " => "
+
+// nameRule replaces all matches of a regular expression in game names.
+type nameRule struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+// nameRules are applied to game names in order, each to the result of the
+// previous one.
+type nameRules []nameRule
+
+// loadNameRules reads a file of "regex => replacement" lines. Empty lines
+// and lines starting with '#' are ignored. The replacement may refer to
+// submatches as $1 etc. and is taken verbatim, so "_ =>  " replaces
+// underscores with spaces.
+func loadNameRules(path string) (nameRules, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var rules nameRules
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSuffix(s.Text(), "\r")
+		if trimmed := strings.TrimSpace(line); len(trimmed) == 0 || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		pattern, repl, ok := strings.Cut(line, nameRuleSeparator)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected regex%sreplacement", n, nameRuleSeparator)
+		}
+		re, err := regexp.Compile(strings.TrimSpace(pattern))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		rules = append(rules, nameRule{re, repl})
+	}
+	return rules, s.Err()
+}
+
+// apply returns name with all rules applied.
+func (rules nameRules) apply(name string) string {
+	for _, r := range rules {
+		name = r.re.ReplaceAllString(name, r.repl)
+	}
+	return name
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadNameRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		applyTo string
+		want    string
+		wantErr bool
+	}{
+		{"replacement is verbatim", "_ =>  \n", "Super_Mario_Land", "Super Mario Land", false},
+		{"in order", "# tidy up\n\n\\s*\\(.*\\) => \n  \\s+Rev [0-9]+$ => \n", "Tetris (World) Rev 1", "Tetris", false},
+		{"submatches", `^(.*), The => The $1` + "\r\n", "Legend of Zelda, The", "The Legend of Zelda", false},
+		{"no rules", "# nothing\n", "Tetris", "Tetris", false},
+		{"missing separator", "foo -> bar\n", "", "", true},
+		{"bad regex", "( => x\n", "", "", true},
+	}
+	dir := t.TempDir()
+	for i, tt := range tests {
+		path := filepath.Join(dir, "rules"+string(rune('a'+i)))
+		if err := os.WriteFile(path, []byte(tt.file), 0644); err != nil {
+			t.Fatal(err)
+		}
+		rules, err := loadNameRules(path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: loadNameRules = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil {
+			if got := rules.apply(tt.applyTo); got != tt.want {
+				t.Errorf("%s: apply(%q) = %q, want %q", tt.name, tt.applyTo, got, tt.want)
+			}
+		}
+	}
+}
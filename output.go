@@ -0,0 +1,405 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// imageFormat is a file format generated images can be written in.
+type imageFormat struct {
+	Name   string
+	Ext    string
+	Encode func(w io.Writer, img image.Image) error
+}
+
+const jpegQuality = 90
+
+// renderVersion is increased whenever a change makes images render
+// differently, so that images rendered before get regenerated.
+const renderVersion = 1
+
+// renderVersionKey is the PNG text chunk keyword renderVersion is stored
+// under.
+const renderVersionKey = "RenderVersion"
+
+// icoSizes are the resolutions contained in generated ICO files.
+var icoSizes = []int{32, 64, 128}
+
+var imageFormats = map[string]imageFormat{
+	"png": {"png", ".png", png.Encode},
+	"jpg": {"jpg", ".jpg", func(w io.Writer, img image.Image) error {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+	}},
+	"ico": {"ico", ".ico", encodeICO},
+}
+
+// formatAliases maps alternative spellings to the names in imageFormats.
+var formatAliases = map[string]string{
+	"jpeg": "jpg",
+}
+
+// normalizeFormat turns a format name or file extension like ".JPEG" into
+// the canonical, lower case name used in imageFormats.
+func normalizeFormat(name string) string {
+	name = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "."))
+	if alias, ok := formatAliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+func init() {
+	image.RegisterFormat("ico", "\x00\x00\x01\x00", decodeICO, decodeICOConfig)
+}
+
+// expectedSize returns the size of the images written with opts, or 0, 0
+// if it depends on the artwork.
+func (opts *Options) expectedSize() (int, int) {
+	if opts.Tight && opts.Mockup == nil {
+		return 0, 0
+	}
+	if opts.Format.Name == "ico" {
+		s := icoSizes[len(icoSizes)-1]
+		return s, s
+	}
+	if opts.Mockup != nil {
+		b := opts.Mockup.Bounds()
+		return b.Dx(), b.Dy()
+	}
+	return opts.CanvasW, opts.CanvasH
+}
+
+// encodeImage writes img to w in opts.Format, adding the metadata requested
+// in opts.
+func (opts *Options) encodeImage(w io.Writer, img image.Image) error {
+	if opts.Format.Name != "png" || opts.DPI <= 0 {
+		return opts.Format.Encode(w, img)
+	}
+	var buf bytes.Buffer
+	if err := opts.Format.Encode(&buf, img); err != nil {
+		return err
+	}
+	// pHYs stores pixels per metre, for both axes
+	ppm := uint32(math.Round(opts.DPI / 0.0254))
+	phys := make([]byte, 9)
+	binary.BigEndian.PutUint32(phys[0:], ppm)
+	binary.BigEndian.PutUint32(phys[4:], ppm)
+	phys[8] = 1 // unit is the metre
+	data, err := insertPNGChunk(buf.Bytes(), "pHYs", phys)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// imageEncoder returns the encoder for an image generated from sources.
+// With EmbedMetadata, PNGs get text chunks naming the sources and the
+// options used.
+func (opts *Options) imageEncoder(sources []string) func(io.Writer, image.Image) error {
+	if !opts.EmbedMetadata || opts.Format.Name != "png" {
+		return opts.encodeImage
+	}
+	return func(w io.Writer, img image.Image) error {
+		var buf bytes.Buffer
+		if err := opts.encodeImage(&buf, img); err != nil {
+			return err
+		}
+		data := buf.Bytes()
+		// Chunks are inserted right after IHDR, so add them in reverse.
+		texts := [][2]string{
+			{"Software", "rg35xx-artgen"},
+			{renderVersionKey, strconv.Itoa(renderVersion)},
+			{"Source", strings.Join(sources, "\n")},
+			{"Options", opts.MetadataOptions},
+		}
+		for i := len(texts) - 1; i >= 0; i-- {
+			if len(texts[i][1]) == 0 {
+				continue
+			}
+			typ, payload := pngText(texts[i][0], texts[i][1])
+			var err error
+			if data, err = insertPNGChunk(data, typ, payload); err != nil {
+				return err
+			}
+		}
+		_, err := w.Write(data)
+		return err
+	}
+}
+
+// pngText returns the type and payload of a PNG text chunk: tEXt for plain
+// ASCII, and iTXt, which is UTF-8, for anything else (like most non-English
+// file names).
+func pngText(keyword, text string) (string, []byte) {
+	payload := append([]byte(keyword), 0)
+	for _, r := range text {
+		if r > 0x7f {
+			// No compression, and empty language tag and translated keyword.
+			payload = append(payload, 0, 0, 0, 0)
+			return "iTXt", append(payload, text...)
+		}
+	}
+	return "tEXt", append(payload, text...)
+}
+
+// imageRenderVersion returns the renderVersion stamped into the PNG at
+// path by --embed_metadata, or 0 if there is none.
+func imageRenderVersion(path string) int {
+	data, err := ioutil.ReadFile(path)
+	if err != nil || len(data) < 8 || string(data[1:4]) != "PNG" {
+		return 0
+	}
+	for pos := 8; pos+8 <= len(data); {
+		n := int(binary.BigEndian.Uint32(data[pos:]))
+		typ := string(data[pos+4 : pos+8])
+		if typ == "IDAT" || pos+12+n > len(data) {
+			break
+		}
+		if typ == "tEXt" {
+			key, val, _ := strings.Cut(string(data[pos+8:pos+8+n]), "\x00")
+			if key == renderVersionKey {
+				v, _ := strconv.Atoi(val)
+				return v
+			}
+		}
+		pos += 12 + n
+	}
+	return 0
+}
+
+// insertPNGChunk returns the PNG file data with a chunk of the given type
+// inserted right after the IHDR chunk.
+func insertPNGChunk(data []byte, typ string, payload []byte) ([]byte, error) {
+	const sigLen = 8
+	if len(data) < sigLen+8 || string(data[sigLen+4:sigLen+8]) != "IHDR" {
+		return nil, errors.New("not a PNG file")
+	}
+	pos := sigLen + 12 + int(binary.BigEndian.Uint32(data[sigLen:]))
+	if pos > len(data) {
+		return nil, errors.New("truncated PNG file")
+	}
+
+	chunk := make([]byte, 0, len(payload)+12)
+	chunk = binary.BigEndian.AppendUint32(chunk, uint32(len(payload)))
+	chunk = append(chunk, typ...)
+	chunk = append(chunk, payload...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	res := make([]byte, 0, len(data)+len(chunk))
+	res = append(res, data[:pos]...)
+	res = append(res, chunk...)
+	return append(res, data[pos:]...), nil
+}
+
+// writeImage encodes img into path. If atomic is set, the image is written
+// to a temporary file first that is only renamed to path once it is
+// complete; on errors, the temporary file is removed.
+func writeImage(path string, img image.Image, encode func(io.Writer, image.Image) error, atomic bool) error {
+	target := path
+	if atomic {
+		target = path + ".tmp"
+	}
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	err = encode(out, img)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if atomic {
+		if err == nil {
+			err = os.Rename(target, path)
+		}
+		if err != nil {
+			os.Remove(target)
+		}
+	}
+	return err
+}
+
+// writeImage writes img encoded with encode to path, within opts.Budget.
+// Failures to write are errWrite errors.
+func (opts *Options) writeImage(path string, img image.Image, encode func(io.Writer, image.Image) error) error {
+	if opts.Budget == nil {
+		if err := writeImage(path, img, encode, opts.Atomic); err != nil {
+			return fmt.Errorf("%w %s: %w", errWrite, path, err)
+		}
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := encode(&buf, img); err != nil {
+		return err
+	}
+	return opts.Budget.write(path, int64(buf.Len()), func() error {
+		write := func(w io.Writer, _ image.Image) error {
+			_, err := w.Write(buf.Bytes())
+			return err
+		}
+		if err := writeImage(path, img, write, opts.Atomic); err != nil {
+			return fmt.Errorf("%w %s: %w", errWrite, path, err)
+		}
+		return nil
+	})
+}
+
+// mipmapName returns the file name of mipmap level of the image path.
+func mipmapName(path string, level int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s_mip%d%s", strings.TrimSuffix(path, ext), level, ext)
+}
+
+// writeMipmaps writes up to opts.Mipmaps levels of img next to path, each
+// half the size of the previous one, and stops early once a level would be
+// smaller than a pixel. Levels count against opts.Budget like any other
+// image.
+func writeMipmaps(opts *Options, path string, img image.Image, encode func(io.Writer, image.Image) error) error {
+	prev := img
+	for level := 1; level <= opts.Mipmaps; level++ {
+		b := prev.Bounds()
+		w, h := b.Dx()/2, b.Dy()/2
+		if w < 1 || h < 1 {
+			return nil
+		}
+		scaled := scaleImage(opts, prev, w, h, opts.scalerFor(b.Dx(), b.Dy(), w, h))
+		name := mipmapName(path, level)
+		if err := opts.writeImage(name, finishImage(opts, scaled), encode); err != nil {
+			return err
+		}
+		prev = scaled
+	}
+	return nil
+}
+
+// encodeICO writes img as an ICO file with one PNG-compressed entry per
+// size in icoSizes. Non-square images are centered on a transparent square
+// first.
+func encodeICO(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	side := maxInt(bounds.Dx(), bounds.Dy())
+	square := image.NewRGBA(image.Rect(0, 0, side, side))
+	offset := image.Point{(side - bounds.Dx()) / 2, (side - bounds.Dy()) / 2}
+	draw.Draw(square, bounds.Sub(bounds.Min).Add(offset), img, bounds.Min, draw.Src)
+
+	var entries [][]byte
+	for _, size := range icoSizes {
+		scaled := image.NewRGBA(image.Rect(0, 0, size, size))
+		draw.CatmullRom.Scale(scaled, scaled.Rect, square, square.Rect, draw.Src, nil)
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, scaled); err != nil {
+			return err
+		}
+		entries = append(entries, buf.Bytes())
+	}
+
+	// ICONDIR, followed by one ICONDIRENTRY per image
+	header := []uint16{0, 1, uint16(len(entries))}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	offs := uint32(6 + 16*len(entries))
+	for i, data := range entries {
+		dim := uint8(icoSizes[i]) // 256 wraps to 0, as the format wants it
+		entry := struct {
+			W, H, Colors, Reserved uint8
+			Planes, BitCount       uint16
+			Size, Offset           uint32
+		}{dim, dim, 0, 0, 1, 32, uint32(len(data)), offs}
+		if err := binary.Write(w, binary.LittleEndian, entry); err != nil {
+			return err
+		}
+		offs += uint32(len(data))
+	}
+	for _, data := range entries {
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readICOLargest returns the data of the largest image in an ICO file.
+func readICOLargest(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 6 {
+		return nil, errors.New("ico: file too short")
+	}
+	count := int(binary.LittleEndian.Uint16(data[4:]))
+	best, bestSize := -1, -1
+	for i := 0; i < count; i++ {
+		e := 6 + 16*i
+		if e+16 > len(data) {
+			return nil, errors.New("ico: truncated directory")
+		}
+		size := int(data[e])
+		if size == 0 {
+			size = 256
+		}
+		if size > bestSize {
+			best, bestSize = e, size
+		}
+	}
+	if best < 0 {
+		return nil, errors.New("ico: no images")
+	}
+	size := binary.LittleEndian.Uint32(data[best+8:])
+	offs := binary.LittleEndian.Uint32(data[best+12:])
+	if uint64(offs)+uint64(size) > uint64(len(data)) {
+		return nil, errors.New("ico: truncated image data")
+	}
+	return data[offs : offs+size], nil
+}
+
+// decodeICO decodes the largest image of an ICO file. Only PNG-compressed
+// entries, as written by encodeICO, are supported.
+func decodeICO(r io.Reader) (image.Image, error) {
+	data, err := readICOLargest(r)
+	if err != nil {
+		return nil, err
+	}
+	return png.Decode(bytes.NewReader(data))
+}
+
+func decodeICOConfig(r io.Reader) (image.Config, error) {
+	data, err := readICOLargest(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return png.DecodeConfig(bytes.NewReader(data))
+}
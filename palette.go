@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// loadPalette reads a palette file. Both GIMP palettes (.gpl) and plain
+// lists of RRGGBB colors, as exported by e.g. Lospec, are supported; in the
+// latter, lines starting with ';' are comments.
+func loadPalette(path string) (color.Palette, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var p color.Palette
+	scanner := bufio.NewScanner(f)
+	gpl := false
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if n == 1 && line == "GIMP Palette" {
+			gpl = true
+			continue
+		}
+		if len(line) == 0 || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if gpl {
+			c, ok, err := parseGPLLine(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", n, err)
+			}
+			if ok {
+				p = append(p, c)
+			}
+			continue
+		}
+		c, err := parseColor(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		p = append(p, c)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(p) == 0 {
+		return nil, errors.New("no colors")
+	}
+	if len(p) > 256 {
+		return nil, fmt.Errorf("%d colors, at most 256 are supported", len(p))
+	}
+	return p, nil
+}
+
+// parseGPLLine parses a color line of a GIMP palette, "R G B name". Header
+// lines like "Name: x" and comments are skipped by returning false.
+func parseGPLLine(line string) (color.Color, bool, error) {
+	if strings.HasPrefix(line, "#") || strings.Contains(line, ":") {
+		return nil, false, nil
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return nil, false, fmt.Errorf("invalid color %q", line)
+	}
+	var rgb [3]uint8
+	for i := range rgb {
+		v, err := strconv.ParseUint(fields[i], 10, 8)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid color %q", line)
+		}
+		rgb[i] = uint8(v)
+	}
+	return color.RGBA{rgb[0], rgb[1], rgb[2], 0xff}, true, nil
+}
+
+// quantize maps img onto the colors of p, optionally with Floyd-Steinberg
+// dithering. If img may be transparent and p has no transparent color, one
+// is added if there is room.
+func quantize(img image.Image, p color.Palette, opaque, dither bool) *image.Paletted {
+	if !opaque && len(p) < 256 {
+		hasTransparent := false
+		for _, c := range p {
+			if _, _, _, a := c.RGBA(); a == 0 {
+				hasTransparent = true
+				break
+			}
+		}
+		if !hasTransparent {
+			p = append(color.Palette{color.Transparent}, p...)
+		}
+	}
+	dst := image.NewPaletted(img.Bounds(), p)
+	if dither {
+		draw.FloydSteinberg.Draw(dst, dst.Rect, img, img.Bounds().Min)
+	} else {
+		draw.Draw(dst, dst.Rect, img, img.Bounds().Min, draw.Src)
+	}
+	return dst
+}
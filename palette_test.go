@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func sameColor(a, b color.Color) bool {
+	r1, g1, b1, a1 := a.RGBA()
+	r2, g2, b2, a2 := b.RGBA()
+	return r1 == r2 && g1 == g2 && b1 == b2 && a1 == a2
+}
+
+func TestParseGPLLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    color.Color
+		wantOK  bool
+		wantErr bool
+	}{
+		{"255 0 128 Pink", color.RGBA{255, 0, 128, 255}, true, false},
+		{"  15\t56  15", color.RGBA{15, 56, 15, 255}, true, false},
+		{"Name: Game Boy", nil, false, false},
+		{"Columns: 4", nil, false, false},
+		{"# a comment", nil, false, false},
+		{"255 0", nil, false, true},
+		{"256 0 0", nil, false, true},
+		{"red green blue", nil, false, true},
+	}
+	for _, tt := range tests {
+		c, ok, err := parseGPLLine(tt.line)
+		if ok != tt.wantOK || (err != nil) != tt.wantErr || ok && !sameColor(c, tt.want) {
+			t.Errorf("parseGPLLine(%q) = %v, %v, %v; want %v, %v, error %v", tt.line, c, ok, err, tt.want, tt.wantOK, tt.wantErr)
+		}
+	}
+}
+
+func TestLoadPalette(t *testing.T) {
+	gb := []color.Color{color.RGBA{15, 56, 15, 255}, color.RGBA{48, 98, 48, 255}, color.RGBA{139, 172, 15, 255}, color.RGBA{155, 188, 15, 255}}
+	tests := []struct {
+		name    string
+		file    string
+		want    []color.Color
+		wantErr bool
+	}{
+		{"gimp", "GIMP Palette\nName: Game Boy\nColumns: 4\n#\n15 56 15 darkest\n48 98 48\n139 172 15\n155 188 15 lightest\n", gb, false},
+		{"hex list", "; Lospec export\n0f380f\n306230\n\n8bac0f\n9bbc0f\n", gb, false},
+		{"empty", "; nothing\n", nil, true},
+		{"bad gimp color", "GIMP Palette\n15 56\n", nil, true},
+		{"bad hex color", "0f380f\nzzzzzz\n", nil, true},
+		// The header is only recognized in the first line.
+		{"late header", "0f380f\nGIMP Palette\n", nil, true},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(path, []byte(tt.file), 0644); err != nil {
+			t.Fatal(err)
+		}
+		p, err := loadPalette(path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: loadPalette = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if len(p) != len(tt.want) {
+			t.Errorf("%s: got %d colors, want %d", tt.name, len(p), len(tt.want))
+			continue
+		}
+		for i := range p {
+			if !sameColor(p[i], tt.want[i]) {
+				t.Errorf("%s: color %d is %v, want %v", tt.name, i, p[i], tt.want[i])
+			}
+		}
+	}
+
+	// At most 256 colors fit into a paletted image.
+	path := filepath.Join(dir, "too many")
+	var many []byte
+	for i := 0; i < 257; i++ {
+		many = append(many, []byte("000000\n")...)
+	}
+	if err := os.WriteFile(path, many, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadPalette(path); err == nil {
+		t.Errorf("loading 257 colors succeeded, want an error")
+	}
+}
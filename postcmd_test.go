@@ -0,0 +1,50 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    []string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"   ", nil, false},
+		{"pngquant {path}", []string{"pngquant", "{path}"}, false},
+		{"  optipng\t-o2 \n {path} ", []string{"optipng", "-o2", "{path}"}, false},
+		{`convert "{path}" -strip '{path}'`, []string{"convert", "{path}", "-strip", "{path}"}, false},
+		{`cp {path} "/mnt/SD card/imgs"`, []string{"cp", "{path}", "/mnt/SD card/imgs"}, false},
+		{`echo "it's" 'say "hi"'`, []string{"echo", "it's", `say "hi"`}, false},
+		{`a""b`, []string{"ab"}, false},
+		{`x ""`, []string{"x", ""}, false},
+		// There are no escapes.
+		{`a\ b`, []string{`a\`, "b"}, false},
+		{`echo "unterminated`, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := splitArgs(tt.s)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitArgs(%q) = %q, %v; want %q, error %v", tt.s, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
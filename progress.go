@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import "path/filepath"
+
+// Status is the outcome of generating a single image.
+type Status int
+
+const (
+	StatusCreated Status = iota
+	StatusFailed
+	StatusSkipped
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusCreated:
+		return "created"
+	case StatusFailed:
+		return "failed"
+	case StatusSkipped:
+		return "skipped"
+	}
+	return "unknown"
+}
+
+// ProgressFunc is called once for every image that was processed. game is
+// the name of the output image without extension, i.e. including the
+// variant suffix. err is only set if status is StatusFailed. main sets
+// logProgress; as there is no library API, other front ends are changes
+// to main.
+type ProgressFunc func(console, game string, status Status, err error)
+
+func (opts *Options) report(console, game string, status Status, err error) {
+	if status == StatusFailed {
+		opts.ErrorLog.record(console, game, err)
+	}
+	if opts.Progress != nil {
+		opts.Progress(console, game, status, err)
+	}
+}
+
+// logProgress returns a ProgressFunc that logs every processed image.
+func logProgress(opts *Options) ProgressFunc {
+	return func(console, game string, status Status, err error) {
+		switch status {
+		case StatusCreated:
+			targetName := filepath.Join(outputDir(opts, console), game+opts.Format.Ext)
+			logger.Printf("Created image for %s/%s in %s", console, game, targetName)
+		case StatusFailed:
+			logger.Printf("Can't generate image for %s/%s: %s\n", console, game, err)
+		case StatusSkipped:
+			logger.Printf("Skipped %s/%s", console, game)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Resolver finds the artwork file of a game, so that where artwork comes
+// from is independent of how images are composed from it. Resolve returns
+// errNoArtwork if there is none. If the returned reader has a
+// Name() string method like *os.File, its result is recorded as the
+// artwork's source.
+type Resolver interface {
+	Resolve(console, game string) (io.ReadCloser, error)
+}
+
+// DirResolver finds artwork named after the game in Dir, trying the
+// extensions of artworkExts in order.
+type DirResolver struct {
+	Dir string
+}
+
+func (r DirResolver) Resolve(console, game string) (io.ReadCloser, error) {
+	for _, ext := range artworkExts {
+		f, err := os.Open(filepath.Join(r.Dir, game+ext))
+		if err == nil {
+			return f, nil
+		}
+	}
+	return nil, errNoArtwork
+}
+
+// ArchiveResolver finds artwork in the first of titlesArchives in Dir that
+// has it.
+type ArchiveResolver struct {
+	Dir string
+}
+
+func (r ArchiveResolver) Resolve(console, game string) (io.ReadCloser, error) {
+	found := false
+	for _, name := range titlesArchives {
+		path := filepath.Join(r.Dir, name)
+		if !fileExists(path) {
+			continue
+		}
+		found = true
+		archive, err := openArtArchive(path)
+		if err != nil {
+			return nil, err
+		}
+		rc, err := archive.open(game)
+		if errors.Is(err, errNoArtwork) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return namedReadCloser{rc, path}, nil
+	}
+	if found {
+		return nil, errNoArtwork
+	}
+	return nil, fmt.Errorf("No titles archive in %q", r.Dir)
+}
+
+// namedReadCloser is a reader with the Name of the file it reads from.
+type namedReadCloser struct {
+	io.ReadCloser
+	name string
+}
+
+func (r namedReadCloser) Name() string {
+	return r.name
+}
+
+// loadResolved decodes the artwork r resolves for a game. It returns the
+// image and the file it was loaded from, if r tells.
+func loadResolved(r Resolver, console, game string) (image.Image, string, error) {
+	rc, err := r.Resolve(console, game)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rc.Close()
+	var src string
+	if n, ok := rc.(interface{ Name() string }); ok {
+		src = n.Name()
+	}
+	img, _, err := image.Decode(rc)
+	return img, src, err
+}
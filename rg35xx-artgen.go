@@ -18,22 +18,29 @@
 package main
 
 import (
-	"archive/zip"
+	"bufio"
+	"crypto/sha256"
+	"database/sql"
 	"errors"
 	"flag"
 	"fmt"
 	"image"
+	"image/color"
 	"io/ioutil"
 	"log"
+	"math"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"golang.org/x/image/draw"
 
 	_ "image/gif"
 	_ "image/jpeg"
-	"image/png"
+	_ "image/png"
 )
 
 /*
@@ -71,144 +78,2509 @@ const (
 	screenH = 480
 )
 
+// Exit codes, see README.md.
+const (
+	exitOK          = 0
+	exitFailures    = 2
+	exitConfigError = 3
+)
+
 var (
-	flagRomDir        = flag.String("rom_dir", "", "Root directory of all roms")
-	flagMameExtrasDir = flag.String("mame_extras", "", "MAME Extras directory")
-	flagMediaDir      = flag.String("media_dir", "media", "")
-	flagConsoles      = flag.String("consoles", "gb,gbc,gba,arcade,mame2000", "Consoles to look at")
+	flagRomDir         = flag.String("rom_dir", "", "Root directory of all roms")
+	flagMameExtrasDir  = flag.String("mame_extras", "", "MAME Extras directory")
+	flagMediaDir       = flag.String("media_dir", "media", "")
+	flagScraper        = flag.String("scraper", "", "Find artwork where this scraper stores it instead of in --media_dir: "+strings.Join(scraperNames(), ", ")+"; variants pick the kind of artwork with kind=")
+	flagMediaMap       = flag.String("media_map", "", "Per-console media directories overriding --media_dir, e.g. \"gb=/mnt/a/gb,arcade=/mnt/b/arcade\"")
+	flagOutputRoot     = flag.String("output_root", "", "Root directory for generated images; defaults to --rom_dir")
+	flagRomExts        = flag.String("rom_exts", "", "ROM file extensions per console overriding the built-in ones, e.g. \"gb=gb:zip,psx=chd\"; \"*\" processes all files")
+	flagConsoleAliases = flag.String("console_aliases", "", "Additional console aliases for artwork lookup, e.g. \"genesis=sega_md\"; a console's media folder falls back to its aliases' if it is missing or empty")
+	flagConsoleMap     = flag.String("console_map", "", "Console names for ROM folders named differently, e.g. \"Nintendo - Game Boy=gb\"; output and artwork lookup use the console name")
+	flagConsoles       = flag.String("consoles", "gb,gbc,gba,arcade,mame2000", "Consoles to look at, in this order. Supports glob patterns like \"mame*\" and braces like \"gb{,c,a}\"; \"all\" is every directory in --rom_dir")
+	flagIgnoreConsoles = flag.String("ignore_consoles", "", "Comma-separated directories (glob patterns allowed) that console patterns and \"all\" skip, in addition to "+strings.Join(defaultIgnoredConsoles, ", "))
+	flagPriority       = flag.String("priority", "", "Console priorities, e.g. \"gba=10,mame*=-1\"; consoles with higher priorities are processed first, others in --consoles order")
+
+	flagImgDir         = flag.String("img_dir", "imgs", "Directory inside each console's output directory the images are written to")
+	flagOnAmbiguous    = flag.String("on_ambiguous", ambiguousFirst, "How to pick among several files that match a game by title equally well: "+strings.Join(ambiguousPolicies, ", ")+"; skip uses none and logs the candidates")
+	flagRegionPriority = flag.String("region_priority", "", "Comma-separated regions, e.g. USA,Europe,Japan, whose artwork is preferred in this order when several files match a game by title")
+	flagMatchTiers     = flag.String("match_tiers", "exact,title", "Comma-separated ways to match artwork to games, tried in order: \"exact\" names, and \"title\", ignoring everything in parentheses or brackets")
+	flagVerbose        = flag.Bool("verbose", false, "Log more details, like how the artwork for each game was found")
+
+	flagShardByLetter = flag.Bool("shard_by_letter", false, "Write images into subdirectories of --img_dir named after their first letter, e.g. imgs/T/Tetris.png, or imgs/0 for names not starting with a letter, for huge sets on slow SD cards")
+	flagNameTemplate  = flag.String("name_template", "{game}", "File name of the images without extension; {game}, {title}, and {console} are replaced")
+	flagNameHash      = flag.Int("name_hash", 0, "If > 0, append this many hex digits of a hash of console and game to file names, e.g. Tetris-3f2a.png, so that games of different consoles can't collide in a shared directory")
+	flagFrontend      = flag.String("frontend", "", "Use the image layout of a frontend, overriding --img_dir and --name_template: stock, garlic, muos, or es")
+
+	flagDetect = flag.String("detect", "", "Inspect a device or frontend directory and print the flags matching its layout")
+
+	flagGame    = flag.String("game", "", "Only generate the image for this game (requires --console)")
+	flagConsole = flag.String("console", "", "Console of the game given with --game")
+	flagOut     = flag.String("out", "", "Output file for --game; \"-\" writes the image to stdout")
+	flagPNG16   = flag.Bool("png_16bit", false, "Render and write PNGs with 16 bits per channel, avoiding banding in gradients; files get considerably larger")
+	flagFormat  = flag.String("format", "png", "Output format: png, jpg (or jpeg), or ico")
+
+	flagVariants variantsFlag
+
+	flagLayers = flag.String("layers", "", "JSON file describing the layers each image is composed of, replacing the default composition")
+
+	flagServe = flag.String("serve", "", "Instead of writing files, serve previews on this address, e.g. \":8080\"")
+
+	flagFallbackRaw = flag.Bool("fallback_raw", false, "If composing an image fails, write the artwork plainly scaled into its box instead")
+
+	flagPlaceholder    = flag.Bool("placeholder", false, "Generate a placeholder card for games without artwork")
+	flagPlaceholderArt = flag.String("placeholder_art", "", "Image to use for games without artwork; implies --placeholder")
+
+	flagGamesFile = flag.String("games_file", "", "File listing the only games (or ROM filenames) to generate images for, one per line")
+	flagNoArtOK   = flag.String("no_art_ok", "", "File listing games (or ROM filenames) known to have no artwork, one per line; they are silently skipped")
+
+	flagFavoritesOnly = flag.Bool("favorites_only", false, "Only generate images for favorites, from each console's gamelist.xml, --favorites, and --badges")
+	flagFavorites     = flag.String("favorites", "", "File listing favorite games, one per line, or a directory (like muOS's info/favourite) whose file names are the favorites")
+
+	flagIncludeHidden = flag.Bool("include_hidden", false, "Also process hidden files and OS-generated system files")
+
+	flagVideoFrame = flag.String("video_frame", "", "Use this frame of .mp4/.mkv/.webm/.avi media for games without images: a time like 5s or 00:01:02.5, or a frame number; requires ffmpeg")
+
+	flagMinSource     = flag.String("min_source", "", "Minimum size WxH of source artwork; smaller artwork is treated like missing artwork so it can be re-scraped")
+	flagMinSourceWarn = flag.Bool("min_source_warn", false, "Only warn about artwork smaller than --min_source, but use it anyway")
+
+	flagAlphaThreshold = flag.Int("alpha_threshold", 0, "If > 0, make artwork pixels with at least this alpha (0..255) fully opaque")
+	flagAlphaFloor     = flag.Int("alpha_floor", 0, "If > 0, make artwork pixels with less than this alpha (0..255) fully transparent")
+
+	flagHero       = flag.Bool("hero", false, "Also write a full screen hero image of every game's artwork, cropped to fill the screen, to --hero_dir")
+	flagHeroDir    = flag.String("hero_dir", "heroes", "Directory for hero images, relative to the console's output folder")
+	flagHeroBlur   = flag.Int("hero_blur", 0, "Blur radius for hero images, in pixels")
+	flagHeroDarken = flag.Float64("hero_darken", 0, "Darken hero images by this fraction (0..1)")
+
+	flagWheel       = flag.Bool("wheel", false, "Also write every game's logo, trimmed and scaled to --wheel_height, to --wheel_dir, for carousels; requires a format with transparency")
+	flagWheelDir    = flag.String("wheel_dir", "wheel", "Directory for wheel logos, relative to the console's output folder")
+	flagWheelMedia  = flag.String("wheel_media", "", "Directory with the logos, one subdirectory per console, relative to --rom_dir; defaults to the --scraper's wheel folders, or \"wheel\" inside --media_dir")
+	flagWheelHeight = flag.Int("wheel_height", 100, "Height of wheel logos in pixels; logos that would be wider than the screen get shorter")
+
+	flagMockup       = flag.String("mockup", "", "Image of a device to show the generated images on, e.g. for sharing screenshots; see --mockup_screen")
+	flagMockupScreen = flag.String("mockup_screen", "", "Screen of the --mockup device as WxH+X+Y; the generated image is scaled into it")
+
+	flagAtlas    = flag.Bool("atlas", false, "Instead of one image per game, pack all artwork of a console into atlas sheets with a <console>_atlas.json index")
+	flagAtlasMax = flag.Int("atlas_max", 2048, "Maximum width and height of an atlas sheet; must be a power of two")
+
+	flagSystemBanners = flag.String("system_banners", "", "Instead of per-game images, write one <console> banner per console to this directory")
+	flagSystemLogos   = flag.String("system_logos", "", "Directory with <console>.png logos to draw onto system banners")
+	flagBannerPick    = flag.String("banner_pick", "first", "How to pick the game shown on a system banner: \"first\" or \"random\"")
+	flagBannerGames   = flag.String("banner_games", "", "Comma-separated console=game pairs of games to show on system banners")
+
+	flagQuality       = flag.String("quality", qualityGood, "Scaling quality: \"fast\" (bilinear), \"good\" (Catmull-Rom), or \"best\" (Lanczos-3)")
+	flagMipmaps       = flag.Int("mipmaps", 0, "Also write this many mipmap levels of every image, each half the size of the previous one, as <name>_mip<level>")
+	flagAnimated      = flag.Bool("animated", false, "For games whose artwork is an animated GIF, also write an animated GIF of it, with every frame composed like the image, next to the image")
+	flagMinVersion    = flag.Int("min_version", 0, "With --skip_existing, regenerate images stamped by --embed_metadata with a render version below this; images without a stamp count as 0")
+	flagVersion       = flag.Bool("version", false, "Print the render version and exit")
+	flagEmbedMetadata = flag.Bool("embed_metadata", false, "Write the source artwork files and the options used into PNG text chunks")
+
+	flagPrescaleMax = flag.Int("prescale_max", 0, "If > 0, quickly shrink sources whose longer side exceeds this many pixels before scaling them properly")
+
+	flagPreferLargest = flag.Bool("prefer_largest", false, "If a game has artwork in several formats, use the one with the highest resolution instead of the first of "+strings.Join(artworkExts, ", "))
+
+	flagAdaptiveScaler   = flag.Bool("adaptive_scaler", false, "Use nearest neighbor instead of Catmull-Rom for big upscales, keeping pixel art crisp")
+	flagUpscaleThreshold = flag.Float64("upscale_threshold", 2, "Minimum upscale factor for which --adaptive_scaler uses nearest neighbor")
+
+	flagCenterFull    = flag.String("center_full", "", "Comma-separated consoles (glob patterns allowed) whose main image centers the artwork on the whole screen instead of the left panel")
+	flagCenterFullMax = flag.Float64("center_full_max", 0.9, "Fraction (0..1] of the screen the --center_full box spans")
+
+	flagScreenAnchor = flag.String("screen_anchor", "", "Place the artwork at this position of the whole screen instead of in the left panel: "+strings.Join(screenAnchors, ", ")+"; the box only limits its size")
+	flagScreenMargin = flag.Int("screen_margin", 0, "Distance in pixels of --screen_anchor artwork from the edges of the screen")
+
+	flagFillSnap = flag.Int("fill_snap", 0, "Stretch artwork that falls short of filling its box by at most this many pixels, e.g. due to rounding, to fill it exactly; this distorts the aspect ratio slightly, 0 (the default) disables it")
+
+	flagUniformHeight         = flag.Int("uniform_height", 0, "If > 0, scale all artwork to this height in pixels (or the box height, if smaller), letting its width vary; only art too wide for the box gets shorter")
+	flagUniformHeightConsoles = flag.String("uniform_height_consoles", "", "Comma-separated consoles (glob patterns allowed) --uniform_height applies to; all if empty")
+
+	flagOutputAspect = flag.String("output_aspect", "", "Aspect ratio of the generated images as W:H, e.g. 1:1; the width stays at the screen width and the artwork box is scaled along")
 
-	logger = log.Default()
+	flagTheme      = flag.String("theme", "", "JSON file with the layout and effect settings of a theme, see README.md; flags given on the command line take precedence")
+	flagOutputSize = flag.String("output_size", "", "Size of the generated images as WxH, e.g. 1280x960; the artwork box is scaled proportionally")
+	flagCrops      = flag.String("crops", "", "Comma-separated crops as name:WxH, e.g. portrait:320x480,square:400x400; generates one set of images per crop, with the artwork scaled to cover the whole image, in a directory named after the crop inside each image directory")
+	flagSizes      = flag.String("sizes", "", "Comma-separated image sizes as WxH, e.g. 640x480,720x720; generates one set of images per size, in a WxH directory inside each image directory")
+	flagDPI        = flag.Float64("dpi", 0, "If > 0, record this resolution in generated PNG files, for printing")
+
+	flagSuggest    = flag.Bool("suggest", false, "For games without artwork, log the media file with the closest name")
+	flagWarnAspect = flag.Float64("warn_aspect", 0, "Warn if the scaled artwork covers less than this fraction (0..1) of the box, e.g. a banner used as box art")
+
+	flagTight             = flag.Bool("tight", false, "Crop every image to the pixels of its artwork instead of writing the whole screen; --bg_color and --background are not drawn")
+	flagFeather           = flag.Int("feather", 0, "Fade the artwork out over this many pixels at its edges")
+	flagReflection        = flag.Float64("reflection", 0, "Height of a mirrored, fading copy of the artwork drawn beneath it, as a fraction of the artwork's height; 0 disables it")
+	flagReflectionOpacity = flag.Float64("reflection_opacity", 0.4, "Opacity (0..1) of the top of the reflection")
+	flagVignette          = flag.Float64("vignette", 0, "Darken the image towards its edges with this strength (0..1)")
+
+	flagBadges      = flag.String("badges", "", "CSV file with game, and optionally console, favorite, and plays columns; favorites get a star and played games their play count")
+	flagBadgeCorner = flag.String("badge_corner", "top_right", "Corner the badges are drawn in: top_left, top_right, bottom_left, or bottom_right")
+
+	flagSafeInset  = flag.String("safe_inset", "", "Margins to leave empty at the edges of the screen, e.g. for rounded corners, as N or TOP,RIGHT,BOTTOM,LEFT pixels; the artwork box is clipped to the area inside")
+	flagBgColor    = flag.String("bg_color", "", "Background color of the generated images as RRGGBB; transparent if not set")
+	flagBackground = flag.String("background", "", "Image to fill the canvas with, cropped to cover it; a "+consoleBackgroundFile+" in a console's media folder is used instead for that console")
+	flagFlatten    = flag.Bool("flatten", false, "Flatten transparency onto --bg_color (or white) and write opaque images")
+
+	flagPaletteFile = flag.String("palette_file", "", "Quantize all images to the colors in this GIMP palette or RRGGBB list, and write paletted PNGs")
+	flagDither      = flag.Bool("dither", false, "Dither when quantizing to --palette_file")
+
+	flagBorderWidth  = flag.Int("border_width", 0, "Width in pixels of a border drawn around the artwork; 0 disables it")
+	flagBorderColor  = flag.String("border_color", "ffffff", "Color of the border as RRGGBB or RRGGBBAA")
+	flagCornerRadius = flag.Int("corner_radius", 0, "Radius in pixels of the artwork's rounded corners, which the border follows; 0 keeps them square")
+	flagAA           = flag.Int("aa", 4, "Antialiasing of rounded corners and borders: every edge pixel is sampled N x N times; 1 gives hard edges")
+	flagBorderAround = flag.String("border_around", "art", "What the border is drawn around: \"art\" or \"box\"")
+	flagBlend        = flag.String("blend", "over", "How the artwork is combined with the background: over, multiply, screen, or add; layers set theirs in --layers")
+
+	flagErrorJSON    = flag.String("error_json", "", "Write every image that couldn't be generated, with the console, game, stage, and error, to this JSON file")
+	flagLayoutReport = flag.String("layout_report", "", "Write the source size, scaled size, and position of every game's artwork to this CSV (or, if it ends in .json, JSON) file")
+	flagState        = flag.String("state", "", "State file remembering the sources of every image; images whose sources didn't change are skipped")
+
+	flagSkipExisting   = flag.Bool("skip_existing", false, "Don't regenerate images that already exist")
+	flagVerifyExisting = flag.Bool("verify_existing", false, "Regenerate existing images that can't be decoded or have the wrong size; implies --skip_existing")
+
+	flagFailOnError = flag.Bool("fail_on_error", false, "Exit with code 2 if any image could not be generated")
+
+	flagChecksums      = flag.Bool("checksums", false, "Write "+checksumsFileName+" with the SHA-256 sums of all images to each console's output directory, for checking with sha256sum -c")
+	flagIndexJSON      = flag.Bool("index_json", false, "Write <console>.json listing all images in the console's output directory")
+	flagMaxDuration    = flag.Duration("max_duration_per_console", 0, "If > 0, stop starting new games of a console once this much time was spent on it, e.g. 10m")
+	flagMaxOutputBytes = flag.Int64("max_output_bytes", 0, "If > 0, stop once the generated images would take up more than this many bytes")
+	flagVerifyExt      = flag.Bool("verify_ext", false, "Instead of generating images, log artwork files whose extension doesn't match their format, e.g. JPEGs named .png")
+	flagFixExt         = flag.Bool("fix_ext", false, "Like --verify_ext, but rename such files to the right extension")
+	flagImagesDir      = flag.String("images_dir", "", "Instead of generating images for ROMs, compose every image in this directory and write the results named after the images to --output_root, or to --img_dir inside it")
+	flagCoverage       = flag.Bool("coverage", false, "Instead of generating images, print how many ROMs of each console have artwork, without decoding any")
+	flagDiff           = flag.Bool("diff", false, "Instead of writing images, report which existing images would be added or changed, and which have no ROM anymore")
+	flagClean          = flag.Bool("clean", false, "Remove all images from a console's output directory before generating, if rg35xx-artgen wrote to it before")
+	flagKeepEmpty      = flag.Bool("keep_empty", false, "Keep output directories even if no image was written to them")
+
+	flagPostCmd = flag.String("post_cmd", "", "Command run on every written image, e.g. \"oxipng -o2 {path}\"; it is executed directly, not through a shell")
+
+	flagAtomic = flag.Bool("atomic", true, "Write images to a temporary file first and rename them once complete")
+
+	flagArtManifest = flag.String("art_manifest", "", "JSON file mapping consoles and games to artwork files or inline data: URIs, consulted before the media directories")
+
+	flagDB      = flag.String("db", "", "SQLite scraper database to look up artwork paths in (requires building with -tags sqlite)")
+	flagDBQuery = flag.String("db_query", defaultDBQuery, "Query returning the artwork path for the named parameters :console and :game")
+
+	flagDat       = flag.String("dat", "", "Comma-separated list of Logiqx or ClrMamePro DAT files to get canonical game names from")
+	flagNameRules = flag.String("name_rules", "", "File of \"regex => replacement\" lines applied in order to game names before looking up artwork and titles")
+	flagParents   = flag.String("parents", "", "CSV file of clone,parent lines; clones without artwork use their parent's")
+
+	flagPlaylistCollage = flag.Bool("playlist_collage", false, "Compose the artwork of all games listed in an .m3u playlist into one image")
+	flagPlaylistColumns = flag.Int("playlist_columns", 2, "Number of columns in a playlist collage")
+	flagPlaylistSpacing = flag.Int("playlist_spacing", 4, "Spacing in pixels between the tiles of a playlist collage")
+
+	// Logs always go to stderr so that stdout can carry image data.
+	logger = log.New(os.Stderr, "", log.LstdFlags)
+
+	// systemFiles are files that operating systems like to leave behind.
+	systemFiles = map[string]bool{
+		"thumbs.db":   true,
+		"ehthumbs.db": true,
+		"desktop.ini": true,
+		"icon\r":      true,
+	}
+
+	placeholderColor       = color.RGBA{0x40, 0x40, 0x40, 0xff}
+	placeholderBottomColor = color.RGBA{0x18, 0x18, 0x18, 0xff}
 )
 
+func init() {
+	flag.Var(&flagVariants, "variant", "Additional image to generate per game, e.g. \"suffix=-logo,media_dir=logos,box=320x100+15+65\". media_dir is relative to --rom_dir; scaler (nearest, bilinear, catmullrom, lanczos), fit (contain, cover, stretch), and size (WxH) override the main image's settings. Can be repeated.")
+}
+
+// Options holds everything that controls a generation run.
+type Options struct {
+	RomDir        string
+	MameExtrasDir string
+	// ConsoleMap maps ROM folder names to the console names used for
+	// output and artwork lookup, if they differ.
+	ConsoleMap map[string]string
+	// MatchTiers are the enabled ways to match artwork to games, see
+	// matchExact and matchTitle, and titles the title keys of the media
+	// directories.
+	MatchTiers map[string]bool
+	titles     *titleIndex
+	// RegionPriority are the regions whose artwork is preferred when
+	// several files match a game by title, most preferred first.
+	RegionPriority []string
+	// OnAmbiguous picks among several files matching a game by title, see
+	// ambiguousPolicies.
+	OnAmbiguous string
+	// Verbose logs more details.
+	Verbose bool
+	// RomExts are the extensions of ROM files per console; files with other
+	// extensions are skipped. Consoles without an entry, or with a nil entry,
+	// get all their files processed.
+	RomExts map[string][]string
+	// Aliases are the other names of consoles, for finding their artwork.
+	Aliases consoleAliases
+	// OutputRoot mirrors the console structure of RomDir for the generated
+	// images. If empty, images are written into RomDir.
+	OutputRoot string
+
+	// ImgDir is the directory inside each console's output directory, and
+	// NameTemplate the template for file names, see outputName.
+	ImgDir       string
+	NameTemplate string
+	// ShardByLetter files images in subdirectories of ImgDir named after
+	// their first letter, see shardOf.
+	ShardByLetter bool
+	// NameHash, if > 0, is the number of hex digits of the hash appended to
+	// file names, see nameHash.
+	NameHash int
+
+	// Layers, if not nil, replace the default composition of the artwork
+	// on the canvas.
+	Layers []*Layer
+
+	// CanvasW and CanvasH are the size of the generated images.
+	CanvasW, CanvasH int
+
+	// Variants are the images generated per game. The first variant is the
+	// main image.
+	Variants []Variant
+
+	// Games restricts generation to the listed games if not nil.
+	Games gameList
+	// NoArtOK lists games that are known to have no artwork, so missing
+	// artwork is no failure for them.
+	NoArtOK gameList
+	// FavoritesOnly restricts generation to the games marked as favorites
+	// in a console's gamelist, in Favorites, or in Badges.
+	FavoritesOnly bool
+	Favorites     favorites
+
+	// IncludeHidden disables skipping of hidden and system files.
+	IncludeHidden bool
+
+	// MinSource is the minimum size of source artwork; smaller artwork fails
+	// with errSourceTooSmall, or is only warned about with MinSourceWarn.
+	MinSource     canvasSize
+	MinSourceWarn bool
+
+	// AlphaThreshold and AlphaFloor, if > 0, snap nearly opaque and nearly
+	// transparent artwork pixels to fully opaque and transparent.
+	AlphaThreshold uint8
+	AlphaFloor     uint8
+
+	// Hero also writes a full screen image of the artwork, cropped to fill
+	// the canvas, blurred by HeroBlur pixels and darkened by HeroDarken, for
+	// every game to HeroDir.
+	Hero       bool
+	HeroDir    string
+	HeroBlur   int
+	HeroDarken float64
+
+	// Wheel also writes every game's logo from WheelMedia to WheelDir,
+	// trimmed and scaled to WheelHeight.
+	Wheel       bool
+	WheelDir    string
+	WheelMedia  Variant
+	WheelHeight int
+
+	// Mockup, if set, is the image of a device the generated images are
+	// shown on, scaled into its screen MockupScreen.
+	Mockup       image.Image
+	MockupScreen LayoutOpts
+
+	// Atlas packs the artwork of each console into sheets of at most
+	// AtlasMax x AtlasMax pixels instead of writing one image per game.
+	Atlas    bool
+	AtlasMax int
+
+	// SystemBanners, if set, is the directory one banner per console is
+	// written to instead of the per-game images. The banner shows a game
+	// picked according to BannerPick (or BannerGames) with the console's logo
+	// from SystemLogos on top.
+	SystemBanners string
+	SystemLogos   string
+	BannerPick    string
+	BannerGames   map[string]string
+
+	// Mipmaps is the number of half-size levels written next to every
+	// image.
+	Mipmaps int
+	// MinVersion is the lowest render version existing images may have
+	// been stamped with to be skipped.
+	MinVersion int
+	// EmbedMetadata adds text chunks with the sources of an image and
+	// MetadataOptions, the command line flags it was generated with, to
+	// PNGs.
+	EmbedMetadata   bool
+	MetadataOptions string
+
+	// Quality is the scaling preset, one of qualityFast, qualityGood, and
+	// qualityBest.
+	Quality string
+	// Scaler and Fit are the settings of the variant being generated, see
+	// Variant.
+	Scaler string
+	Fit    string
+
+	// PrescaleMax is the longest side in pixels a source may have before it
+	// is shrunk with a fast scaler first; 0 disables prescaling.
+	PrescaleMax int
+
+	// PreferLargest picks the artwork with the most pixels if a game has
+	// several, rather than the first one found.
+	PreferLargest bool
+
+	// AdaptiveScaler picks nearest neighbor scaling for upscales by at
+	// least UpscaleThreshold.
+	AdaptiveScaler   bool
+	UpscaleThreshold float64
+
+	// WarnAspect is the fraction of the box artwork must at least cover to
+	// not be reported as suspicious; 0 disables the check.
+	WarnAspect float64
+	// Suggest logs the closest media file for games without artwork.
+	Suggest bool
+
+	// Feather is the width of the fade at the artwork's edges, in pixels.
+	Feather int
+	// Tight crops images to their non-transparent pixels, leaving out the
+	// canvas and its background.
+	Tight bool
+
+	// Reflection is the height of the reflection beneath the artwork as a
+	// fraction of the artwork's height, starting at ReflectionOpacity.
+	Reflection        float64
+	ReflectionOpacity float64
+
+	// Badges, if not nil, are drawn in BadgeCorner of each game's image.
+	Badges      badgeIndex
+	BadgeCorner string
+
+	// Vignette is the strength of the vignette applied to every image; 0
+	// disables it.
+	Vignette float64
+
+	// CenterFull are patterns of consoles whose main variant uses a box
+	// centered on the canvas, spanning CenterFullMax of it.
+	CenterFull    []string
+	CenterFullMax float64
+
+	// ScreenAnchor, if set, is where artwork is placed on the screen and
+	// in its box, which is moved there, see screenAnchors.
+	ScreenAnchor string
+
+	// UniformHeight, if > 0, is the height artwork is scaled to, so that
+	// all images share it, for the consoles matching UniformHeightConsoles,
+	// or all of them if it is empty.
+	UniformHeight         int
+	UniformHeightConsoles []string
+
+	// FillSnap is how many pixels scaled artwork may fall short of its box
+	// and still be stretched to fill it, see fitLayout.
+	FillSnap int
+
+	// Sizes, if not empty, are the sizes images are generated in instead of
+	// CanvasW x CanvasH, see outputSets.
+	Sizes []canvasSize
+
+	// Crops, if not empty, are the sizes artwork is cover-cropped to, in
+	// one set of images per crop, see cropSets.
+	Crops []crop
+
+	// DPI is the resolution recorded in PNG files; 0 records none.
+	DPI float64
+
+	// SafeInset are margins at the edges of the canvas that are left empty,
+	// e.g. for screens with rounded corners. Artwork boxes are clipped to
+	// the area inside them.
+	SafeInset insets
+
+	// BgColor fills the canvas if not nil.
+	BgColor color.Color
+	// Background, if set, is drawn over BgColor, scaled and cropped to
+	// cover the canvas.
+	Background image.Image
+	// Flatten composites the final image over BgColor, or white if
+	// BgColor is nil, so that it has no transparent pixels.
+	Flatten bool
+
+	// Palette, if not nil, is the palette all images are quantized to,
+	// with Floyd-Steinberg dithering if Dither is set.
+	Palette color.Palette
+	Dither  bool
+
+	// BorderWidth is the width of the border drawn around the artwork, or
+	// around the whole box if BorderAroundBox is set.
+	BorderWidth     int
+	BorderColor     color.Color
+	BorderAroundBox bool
+
+	// CornerRadius, if > 0, rounds the corners of the artwork and the
+	// border. Their edges are antialiased by sampling every pixel AA x AA
+	// times; 1 gives hard edges.
+	CornerRadius int
+	AA           int
+
+	// Blend is how the artwork is combined with the background: "over", or
+	// one of blendFuncs.
+	Blend string
+
+	// Animated also writes an animated GIF next to the image of every game
+	// whose artwork is an animated GIF, see genAnimated.
+	Animated bool
+
+	// SkipExisting skips images that already exist. With VerifyExisting,
+	// existing images are only skipped if they are valid.
+	SkipExisting   bool
+	VerifyExisting bool
+
+	// LayoutReport, if set, collects where the artwork of every image was
+	// placed.
+	LayoutReport *layoutReport
+	// ErrorLog, if set, collects all images that couldn't be generated.
+	ErrorLog *errorLog
+	// State, if set, is used to skip images whose sources didn't change.
+	State *runState
+
+	// Progress, if set, is called for every processed image.
+	Progress ProgressFunc
+
+	// Format is the file format of the generated images.
+	Format imageFormat
+	// PNG16 renders all images with 16 bits per channel. Written as PNG,
+	// they keep that depth.
+	PNG16 bool
+
+	// Atomic makes sure incomplete images never show up in the target dir.
+	Atomic bool
+	// PostCmd, if not nil, is the command and arguments run on every written
+	// image, see runPostCmd.
+	PostCmd []string
+	// Budget, if not nil, limits the number of bytes written.
+	Budget *outputBudget
+	// MaxDurationPerConsole, if > 0, is the time after which no more games
+	// of a console are started.
+	MaxDurationPerConsole time.Duration
+	// KeepEmpty keeps output directories created for consoles without any
+	// generated images.
+	KeepEmpty bool
+	// Clean removes old images from output directories marked as written by
+	// rg35xx-artgen before generating new ones.
+	Clean bool
+	// Diff compares the generated images with the existing ones instead of
+	// writing them.
+	Diff bool
+	// IndexJSON writes an index of the images in each console's output
+	// directory.
+	IndexJSON bool
+	// Checksums writes a manifest of the SHA-256 sums of the images in each
+	// console's output directory.
+	Checksums bool
+
+	// Placeholder enables placeholders for games without artwork.
+	// PlaceholderArt is used as placeholder if set, otherwise a card
+	// showing the game's title is rendered.
+	Placeholder    bool
+	PlaceholderArt image.Image
+
+	// FallbackRaw writes the plainly scaled artwork for games whose image
+	// couldn't be composed.
+	FallbackRaw bool
+
+	// VideoFrame, if not nil, selects the frame taken from videos for games
+	// without still images.
+	VideoFrame *videoFrame
+
+	// ArtDB is consulted for artwork paths before the media directories.
+	ArtDB *artDB
+
+	// ArtManifest is consulted for artwork after ArtDB and before the media
+	// directories.
+	ArtManifest *artManifest
+
+	// Resolver, if not nil, is consulted for artwork after ArtManifest and
+	// before the media directories. No flag sets it; it is where code that
+	// adds a new source of artwork plugs in.
+	Resolver Resolver
+
+	// art caches the artwork of the game currently being generated, if not
+	// nil, so that variants and layers share decoded images.
+	art artCache
+
+	// Dat maps ROM names to canonical game names
+	Dat datIndex
+	// Parents maps clones to their parent sets, in addition to the parents
+	// known from Dat.
+	Parents map[string]string
+	// NameRules rewrite game names before looking up their artwork and
+	// titles.
+	NameRules nameRules
+
+	PlaylistCollage bool
+	PlaylistColumns int
+	PlaylistSpacing int
+}
+
 func fileExists(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil
 }
 
-func loadArtwork(mediaDir, mameExtrasDir, console, game string) (image.Image, error) {
+// mkdirAll creates path along with any missing parents and returns the
+// outermost directory it had to create, or "" if path already existed.
+func mkdirAll(path string) (string, error) {
+	created := ""
+	for p := filepath.Clean(path); !fileExists(p); p = filepath.Dir(p) {
+		created = p
+		if filepath.Dir(p) == p {
+			break
+		}
+	}
+	return created, os.MkdirAll(path, 0755)
+}
+
+// removeEmptyDirs removes path and its parents up to and including top, as
+// long as they are empty.
+func removeEmptyDirs(path, top string) {
+	for p := filepath.Clean(path); os.Remove(p) == nil && p != top; p = filepath.Dir(p) {
+	}
+}
+
+// isJunkFile reports whether filename is a hidden file or a file created by
+// the operating system rather than a ROM.
+func isJunkFile(filename string) bool {
+	return strings.HasPrefix(filename, ".") || systemFiles[strings.ToLower(filename)]
+}
+
+func trimExt(filename string) string {
+	return strings.TrimSuffix(filename, filepath.Ext(filename))
+}
+
+// errNoArtwork is returned if a media directory has no artwork for a game.
+var errNoArtwork = errors.New("No artwork file found")
+
+// errSourceTooSmall is returned for artwork smaller than --min_source.
+var errSourceTooSmall = errors.New("Artwork too small")
+
+// artworkExts are the extensions loadArtwork looks for in media directories.
+var artworkExts = []string{".png", ".gif", ".jpg"}
+
+// loadArtwork returns the artwork for a game and the file it was loaded from.
+func loadArtwork(mediaDir, mameExtrasDir, console, game string) (image.Image, string, error) {
+	return loadResolved(artworkResolver(mediaDir, mameExtrasDir, console), console, game)
+}
+
+// artworkResolver returns the resolver for the artwork files of console.
+func artworkResolver(mediaDir, mameExtrasDir, console string) Resolver {
 	if console == "mame2000" {
-		// Try to get it from zip
-		archive, err := zip.OpenReader(filepath.Join(mameExtrasDir, "titles.zip"))
+		// Try to get it from the titles archive
+		return ArchiveResolver{mameExtrasDir}
+	}
+	return DirResolver{mediaDir}
+}
+
+// largestImageFile returns the one of paths with the most pixels, or the
+// biggest file among images of the same size. Files that don't exist or
+// aren't images are ignored; if none is left, it returns "".
+func largestImageFile(paths []string) string {
+	best := ""
+	var bestPixels, bestSize int64
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil || fi.IsDir() {
+			continue
+		}
+		f, err := os.Open(path)
 		if err != nil {
-			return nil, err
+			continue
 		}
-		defer archive.Close()
-		for _, f := range archive.File {
-			if f.FileInfo().IsDir() {
-				continue
-			}
-			filename := f.FileInfo().Name()
-			filename = strings.TrimSuffix(filename, filepath.Ext(filename))
-			if filename == game {
-				r, err := f.Open()
-				img, _, err := image.Decode(r)
-				archive.Close()
-				return img, err
-			}
+		cfg, _, err := image.DecodeConfig(f)
+		f.Close()
+		if err != nil {
+			continue
+		}
+		pixels := int64(cfg.Width) * int64(cfg.Height)
+		if pixels > bestPixels || (pixels == bestPixels && fi.Size() > bestSize) {
+			best, bestPixels, bestSize = path, pixels, fi.Size()
 		}
-		return nil, errors.New("No artwork found")
 	}
+	return best
+}
 
-	// Check for png, gif, and jpg
-	for _, ext := range []string{".png", ".gif", ".jpg"} {
-		artWorkFile := filepath.Join(mediaDir, game+ext)
-		if fileExists(artWorkFile) {
-			f, err := os.Open(artWorkFile)
-			if err != nil {
-				continue
-			}
-			defer f.Close()
-			image, _, err := image.Decode(f)
-			return image, err
+func loadImageFile(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+// placeholderCard renders a w x h card with the game's title.
+func placeholderCard(title string, w, h int) (image.Image, error) {
+	// 16 bits per channel avoid banding in the gradient with --png_16bit.
+	card := image.NewRGBA64(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		t := float64(y) / float64(h-1)
+		c := color.RGBA64{
+			uint16((float64(placeholderColor.R)*(1-t) + float64(placeholderBottomColor.R)*t) * 0x101),
+			uint16((float64(placeholderColor.G)*(1-t) + float64(placeholderBottomColor.G)*t) * 0x101),
+			uint16((float64(placeholderColor.B)*(1-t) + float64(placeholderBottomColor.B)*t) * 0x101),
+			0xffff,
+		}
+		for x := 0; x < w; x++ {
+			card.SetRGBA64(x, y, c)
 		}
 	}
+	err := drawText(card, card.Rect.Inset(16), cleanTitle(title), 28, color.White)
+	return card, err
+}
 
-	return nil, errors.New("No artwork file found")
+// parseColor parses a color given as RRGGBB or RRGGBBAA, with an optional
+// leading '#'.
+func parseColor(s string) (color.RGBA, error) {
+	s = strings.TrimPrefix(s, "#")
+	var c color.RGBA
+	c.A = 0xff
+	var err error
+	switch len(s) {
+	case 6:
+		_, err = fmt.Sscanf(s, "%02x%02x%02x", &c.R, &c.G, &c.B)
+	case 8:
+		_, err = fmt.Sscanf(s, "%02x%02x%02x%02x", &c.R, &c.G, &c.B, &c.A)
+	default:
+		err = errors.New("wrong length")
+	}
+	if err != nil {
+		return c, fmt.Errorf("Invalid color %q, expected RRGGBB or RRGGBBAA", s)
+	}
+	// color.RGBA is alpha-premultiplied
+	c.R = uint8(uint16(c.R) * uint16(c.A) / 0xff)
+	c.G = uint8(uint16(c.G) * uint16(c.A) / 0xff)
+	c.B = uint8(uint16(c.B) * uint16(c.A) / 0xff)
+	return c, nil
 }
 
-func scaleImage(img image.Image, w, h int) image.Image {
-	scaled := image.NewRGBA(image.Rect(0, 0, w, h))
-	draw.CatmullRom.Scale(scaled, scaled.Rect, img, img.Bounds(), draw.Over, nil)
-	return scaled
+// newImage returns an empty image with the bit depth used for rendering.
+func (opts *Options) newImage(r image.Rectangle) draw.RGBA64Image {
+	if opts.PNG16 {
+		return image.NewRGBA64(r)
+	}
+	return image.NewRGBA(r)
 }
 
-func genImage(mediaDir, mameExtrasDir, console, game string) (image.Image, error) {
-	artwork, err := loadArtwork(mediaDir, mameExtrasDir, console, game)
+// newCanvas returns an empty screen-sized image whose part inside the
+// SafeInset margins is filled with the background color and image, if
+// any.
+func newCanvas(opts *Options) draw.RGBA64Image {
+	img := opts.newImage(image.Rect(0, 0, opts.CanvasW, opts.CanvasH))
+	r := opts.safeRect()
+	if opts.BgColor != nil {
+		draw.Draw(img, r, image.NewUniform(opts.BgColor), image.Point{}, draw.Src)
+	}
+	if opts.Background != nil {
+		draw.Draw(img, r, coverImage(opts, opts.Background, r.Dx(), r.Dy()), image.Point{}, draw.Over)
+	}
+	return img
+}
+
+// newArtCanvas returns the canvas a game's artwork is placed on. With Tight
+// it is left empty, as the images are cropped to the artwork anyway.
+func newArtCanvas(opts *Options) draw.RGBA64Image {
+	if opts.Tight {
+		return opts.newImage(image.Rect(0, 0, opts.CanvasW, opts.CanvasH))
+	}
+	return newCanvas(opts)
+}
+
+// consoleBackgroundFile is the name of the image in a console's media
+// folder that replaces Background for that console.
+const consoleBackgroundFile = "background.png"
+
+// withConsoleBackground returns opts with the consoleBackgroundFile in
+// console's media folder as Background, if there is one.
+func (opts *Options) withConsoleBackground(console string) *Options {
+	path := filepath.Join(opts.Variants[0].consoleMediaDir(console, opts.Aliases), consoleBackgroundFile)
+	if !fileExists(path) {
+		return opts
+	}
+	img, err := loadImageFile(path)
 	if err != nil {
-		return nil, err
+		logger.Printf("Can't load background %s: %s\n", path, err)
+		return opts
 	}
-	bounds := artwork.Bounds()
-	origW, origH := float32(bounds.Dx()), float32(bounds.Dy())
+	o := *opts
+	o.Background = img
+	return &o
+}
 
-	ratio := origW / origH
-	w := float32(artworkMaxW)
-	h := w / ratio
-	if h > artworkMaxH {
-		h = artworkMaxH
-		w = artworkMaxH * ratio
+// flatten composites img over bg, returning an opaque image.
+func flatten(img image.Image, bg color.Color) image.Image {
+	_, _, _, a := bg.RGBA()
+	if a != 0xffff {
+		// Make sure the background itself is opaque, too.
+		r, g, b, _ := bg.RGBA()
+		bg = color.RGBA64{uint16(r), uint16(g), uint16(b), 0xffff}
+	}
+	flat := newImageLike(img, img.Bounds())
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+	return flat
+}
+
+// finishImage applies the steps that are shared by all generated images
+// right before they are encoded.
+func finishImage(opts *Options, img image.Image) image.Image {
+	// JPEG has no alpha channel, so flatten explicitly rather than ending
+	// up with black where the image is transparent.
+	if opts.Flatten || opts.Format.Name == "jpg" {
+		bg := opts.BgColor
+		if bg == nil {
+			bg = color.White
+		}
+		img = flatten(img, bg)
 	}
+	if opts.Palette != nil {
+		img = quantize(img, opts.Palette, opts.Flatten || opts.Format.Name == "jpg", opts.Dither)
+	}
+	return img
+}
 
-	posX := artworkX + int((artworkMaxW-w)/2)
-	posY := artworkY + int((artworkMaxH-h)/2)
+// artKey identifies the artwork of a game in a media directory.
+type artKey struct {
+	mediaDir, game string
+}
 
-	scaled := scaleImage(artwork, int(w), int(h))
+// cachedArt is the result of looking up artwork.
+type cachedArt struct {
+	img image.Image
+	src string
+	err error
+}
 
-	img := image.NewRGBA(image.Rect(0, 0, screenW, screenH))
-	draw.Copy(img, image.Point{posX, posY}, scaled, scaled.Bounds(), draw.Over, nil)
+// artCache remembers artwork that was already looked up and decoded.
+type artCache map[artKey]cachedArt
 
-	return img, nil
+// findArtwork looks up the artwork for a game, first in the art database,
+// if any, then in the media directory, falling back to a frame of the game's
+// video if VideoFrame is set. It returns the artwork and the file
+// it was loaded from.
+func findArtwork(opts *Options, mediaDir, console, game string) (image.Image, string, error) {
+	if opts.ArtDB != nil {
+		path, err := opts.ArtDB.lookup(console, game)
+		if err == nil {
+			img, err := loadImageFile(path)
+			return img, path, err
+		}
+		if err != sql.ErrNoRows {
+			logger.Printf("Can't look up %s/%s in database: %s\n", console, game, err)
+		}
+	}
+	if opts.ArtManifest != nil {
+		if entry := opts.ArtManifest.lookup(console, game); len(entry) > 0 {
+			return opts.ArtManifest.load(entry)
+		}
+	}
+	if opts.Resolver != nil {
+		img, src, err := loadResolved(opts.Resolver, console, game)
+		if !errors.Is(err, errNoArtwork) {
+			return img, src, err
+		}
+	}
+	if opts.PreferLargest && console != "mame2000" {
+		var paths []string
+		for _, ext := range artworkExts {
+			paths = append(paths, filepath.Join(mediaDir, game+ext))
+		}
+		if path := largestImageFile(paths); len(path) > 0 {
+			img, err := loadImageFile(path)
+			return img, path, err
+		}
+	}
+	img, src, err := loadArtwork(mediaDir, opts.MameExtrasDir, console, game)
+	if opts.VideoFrame != nil && err == errNoArtwork {
+		return loadVideoFrame(opts.VideoFrame, mediaDir, game)
+	}
+	return img, src, err
 }
 
-func genImages(romDir, mediaDir, mameExtrasDir, console string) error {
-	romDir = filepath.Join(romDir, console)
-	mediaDir = filepath.Join(mediaDir, console)
-	targetDir := filepath.Join(romDir, "imgs")
+func scaleImage(opts *Options, img image.Image, w, h int, scaler draw.Scaler) draw.RGBA64Image {
+	scaled := opts.newImage(image.Rect(0, 0, w, h))
+	scaler.Scale(scaled, scaled.Bounds(), img, img.Bounds(), draw.Over, nil)
+	return scaled
+}
 
-	os.Mkdir(targetDir, 0755)
-	files, err := ioutil.ReadDir(romDir)
-	if err != nil {
-		return err
+// scalerFor returns the scaler for scaling a srcW x srcH image to w x h:
+// the Scaler of the variant, if it picks one. Otherwise, with
+// AdaptiveScaler, big upscales (typically pixel art) use nearest neighbor
+// to stay crisp; everything else uses the scaler of the quality preset.
+func (opts *Options) scalerFor(srcW, srcH, w, h int) draw.Scaler {
+	if len(opts.Scaler) > 0 {
+		return scalers[opts.Scaler]
+	}
+	if opts.AdaptiveScaler {
+		factor := math.Min(float64(w)/float64(srcW), float64(h)/float64(srcH))
+		if factor >= opts.UpscaleThreshold {
+			return draw.NearestNeighbor
+		}
+	}
+	return qualityScaler(opts.Quality)
+}
+
+// prescale quickly shrinks img so that its longer side is at most maxSize
+// pixels. It never shrinks below twice the final size w x h so that the
+// final high quality scale still has enough pixels to work with.
+func prescale(img image.Image, maxSize, w, h int) image.Image {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	long := srcW
+	if srcH > long {
+		long = srcH
+	}
+	if maxSize <= 0 || long <= maxSize {
+		return img
 	}
 
-	for _, file := range files {
-		if file.IsDir() {
-			continue
+	factor := float64(maxSize) / float64(long)
+	if f := float64(2*w) / float64(srcW); f > factor {
+		factor = f
+	}
+	if f := float64(2*h) / float64(srcH); f > factor {
+		factor = f
+	}
+	if factor >= 1 {
+		return img
+	}
+
+	shrunk := newImageLike(img, image.Rect(0, 0, int(float64(srcW)*factor+0.5), int(float64(srcH)*factor+0.5)))
+	draw.ApproxBiLinear.Scale(shrunk, shrunk.Bounds(), img, bounds, draw.Src, nil)
+	return shrunk
+}
+
+// gameNames returns the display title of a game and the names to look up
+// its artwork by, in order of preference. Names rewritten by NameRules are
+// tried before the names they were derived from.
+func gameNames(opts *Options, game string) (string, []string) {
+	title := game
+	names := []string{game}
+	if e, ok := opts.Dat[game]; ok {
+		title = e.Description
+		if e.Name != game {
+			names = []string{e.Name, game}
 		}
-		filename := file.Name()
-		game := strings.TrimSuffix(filename, filepath.Ext(filename))
-		img, err := genImage(mediaDir, mameExtrasDir, console, game)
-		if err != nil {
-			logger.Printf("Can't generate image for %s/%s: %s\n", console, file.Name(), err)
-			continue
+	}
+	// Clones without artwork of their own use their parent's.
+	if parent := opts.parentOf(names[0]); len(parent) > 0 && parent != game {
+		names = append(names, parent)
+	}
+	if len(opts.NameRules) > 0 {
+		title = opts.NameRules.apply(title)
+		var renamed []string
+		for _, name := range names {
+			if r := opts.NameRules.apply(name); r != name && len(r) > 0 {
+				renamed = append(renamed, r)
+			}
+			renamed = append(renamed, name)
 		}
-		targetName := filepath.Join(targetDir, game+".png")
-		out, err := os.Create(targetName)
-		if err != nil {
-			logger.Printf("Can't create image file %s: %s\n", targetName, err)
-			continue
+		names = renamed
+	}
+	return title, names
+}
+
+// parentOf returns the parent set of a clone, or "" if the game is none.
+func (opts *Options) parentOf(game string) string {
+	if parent, ok := opts.Parents[game]; ok {
+		return parent
+	}
+	if e, ok := opts.Dat[game]; ok {
+		return e.CloneOf
+	}
+	return ""
+}
+
+// findGameArtwork looks up the artwork for a game by all of its names. It
+// returns the artwork and the file it was loaded from.
+func findGameArtwork(opts *Options, mediaDir, console, game string) (image.Image, string, error) {
+	key := artKey{mediaDir, game}
+	if a, ok := opts.art[key]; ok {
+		return a.img, a.src, a.err
+	}
+	img, src, err := findGameArtworkUncached(opts, mediaDir, console, game)
+	if err == nil && opts.MinSource.W > 0 {
+		if b := img.Bounds(); b.Dx() < opts.MinSource.W || b.Dy() < opts.MinSource.H {
+			err = fmt.Errorf("%w: %s is only %dx%d, expected at least %s", errSourceTooSmall, src, b.Dx(), b.Dy(), opts.MinSource)
+			if opts.MinSourceWarn {
+				logger.Printf("%s/%s: %s\n", console, game, err)
+				err = nil
+			} else {
+				img, src = nil, ""
+			}
 		}
-		err = png.Encode(out, img)
-		if err != nil {
-			logger.Printf("Can't encode %s as PNG: %s\n", targetName, err)
-			continue
+	}
+	if err == nil && (opts.AlphaThreshold > 0 || opts.AlphaFloor > 0) {
+		img = snapAlpha(img, opts.AlphaThreshold, opts.AlphaFloor)
+	}
+	if opts.art != nil {
+		opts.art[key] = cachedArt{img, src, err}
+	}
+	return img, src, err
+}
+
+// findGameArtworkUncached is findGameArtwork without the cache.
+func findGameArtworkUncached(opts *Options, mediaDir, console, game string) (image.Image, string, error) {
+	_, names := gameNames(opts, game)
+	err := errNoArtwork
+	if opts.MatchTiers[matchExact] {
+		for _, name := range names {
+			var artwork image.Image
+			var src string
+			if artwork, src, err = findArtwork(opts, mediaDir, console, name); err == nil {
+				opts.logMatch(console, game, matchExact, src)
+				return artwork, src, nil
+			}
+		}
+		if !errors.Is(err, errNoArtwork) {
+			return nil, "", err
 		}
-		out.Close()
-		logger.Printf("Created image for %s/%s in %s", console, game, targetName)
 	}
-	return nil
+	// Archives are looked up by exact name only.
+	if opts.MatchTiers[matchTitle] && console != "mame2000" {
+		if artwork, src, err := opts.findTitleArtwork(mediaDir, names); err != errNoArtwork {
+			if err == nil {
+				opts.logMatch(console, game, matchTitle, src)
+			}
+			return artwork, src, err
+		}
+	}
+	return nil, "", err
 }
 
-func main() {
-	flag.Parse()
+// logMatch logs the tier artwork for a game was found by, in verbose mode.
+func (opts *Options) logMatch(console, game, tier, src string) {
+	if opts.Verbose {
+		logger.Printf("%s/%s: %s match %s\n", console, game, tier, src)
+	}
+}
+
+// loadGameArtwork returns the artwork for a game and the file it was loaded
+// from. If there is none and placeholders are enabled, a w x h placeholder
+// is returned instead, with an empty file name.
+func loadGameArtwork(opts *Options, mediaDir, console, game string, w, h int) (image.Image, string, error) {
+	artwork, src, err := findGameArtwork(opts, mediaDir, console, game)
+	if err == nil || !opts.Placeholder {
+		return artwork, src, err
+	}
+	logger.Printf("Using placeholder for %s/%s: %s\n", console, game, err)
+	if opts.PlaceholderArt != nil {
+		return opts.PlaceholderArt, "", nil
+	}
+	title, _ := gameNames(opts, game)
+	artwork, err = placeholderCard(title, w, h)
+	return artwork, "", err
+}
 
-	if len(*flagRomDir) == 0 {
-		fmt.Printf("--rom_dir not set!\n")
-		os.Exit(1)
+// placeArtwork scales artwork to fit into box and draws it onto dst. It
+// returns the rectangle covered by the artwork.
+func placeArtwork(opts *Options, dst draw.RGBA64Image, artwork image.Image, box LayoutOpts) image.Rectangle {
+	bounds := artwork.Bounds()
+	if opts.UniformHeight > 0 {
+		box = box.withHeight(opts.UniformHeight)
+	}
+	w, h, posX, posY := opts.fitLayout(bounds.Dx(), bounds.Dy(), box)
+	if len(opts.ScreenAnchor) > 0 {
+		posX, posY = anchorPos(opts.ScreenAnchor, w, h, boxRect(box))
+	}
+	if opts.Fit == "cover" || opts.Fit == "stretch" {
+		w, h, posX, posY = box.BoxW, box.BoxH, box.BoxX, box.BoxY
+	}
+	var scaled draw.RGBA64Image
+	if opts.Fit == "cover" {
+		scaled = coverImage(opts, artwork, w, h)
+	} else {
+		scaler := opts.scalerFor(bounds.Dx(), bounds.Dy(), w, h)
+		scaled = scaleImage(opts, opts.shrinkSource(artwork, w, h), w, h, scaler)
+	}
+	if opts.Feather > 0 {
+		featherEdges(scaled, opts.Feather)
+	}
+	r := image.Rect(posX, posY, posX+w, posY+h)
+	target := dst
+	if _, ok := blendFuncs[opts.Blend]; ok {
+		// The artwork is blended from where it ends up.
+		target = opts.newImage(dst.Bounds())
 	}
+	if opts.CornerRadius > 0 {
+		draw.DrawMask(target, r, scaled, scaled.Bounds().Min, roundedMask(r, opts.CornerRadius, opts.AA), r.Min, draw.Over)
+	} else {
+		draw.Copy(target, r.Min, scaled, scaled.Bounds(), draw.Over, nil)
+	}
+	if target != dst {
+		blendImage(dst, target, r.Intersect(dst.Bounds()), opts.Blend)
+	}
+	if opts.Reflection > 0 {
+		drawReflection(dst, scaled, r, opts.Reflection, opts.ReflectionOpacity)
+	}
+	return r
+}
 
-	consoles := strings.Split(*flagConsoles, ",")
-	for _, c := range consoles {
-		c = strings.TrimSpace(c)
-		genImages(*flagRomDir, filepath.Join(*flagRomDir, *flagMediaDir), *flagMameExtrasDir, c)
+// genImage generates the image of a variant for a game. It returns the
+// image and the files it was generated from.
+func genImage(opts *Options, v *Variant, mediaDir, console, game string) (image.Image, []string, error) {
+	var img draw.RGBA64Image
+	var sources []string
+	var err error
+	if opts.Layers != nil {
+		img, sources, err = renderLayers(opts, v, mediaDir, console, game)
+	} else {
+		img, sources, err = composeImage(opts, v, mediaDir, console, game)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	res, err := decorateImage(opts, img, console, game)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, sources, nil
+}
+
+// decorateImage applies the effects, badges and mockup to a composed image.
+func decorateImage(opts *Options, img draw.RGBA64Image, console, game string) (image.Image, error) {
+	if opts.Tight {
+		img = trimTransparent(img)
+	}
+	if opts.Vignette > 0 {
+		applyVignette(img, opts.Vignette)
+	}
+	if b, ok := opts.Badges.lookup(console, game); ok {
+		if err := drawBadges(img, b, opts.BadgeCorner); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Mockup != nil {
+		return applyMockup(opts, img), nil
+	}
+	return img, nil
+}
+
+// genImageWithFallback calls genImage. With FallbackRaw, it falls back to
+// genRawImage if the artwork could be loaded but composing the image
+// failed, even by panicking.
+func genImageWithFallback(opts *Options, v *Variant, mediaDir, console, game string) (img image.Image, sources []string, err error) {
+	if !opts.FallbackRaw {
+		return genImage(opts, v, mediaDir, console, game)
+	}
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%v", r)
+			}
+		}()
+		img, sources, err = genImage(opts, v, mediaDir, console, game)
+	}()
+	if err == nil || errors.Is(err, errNoArtwork) || errors.Is(err, errSourceTooSmall) {
+		return img, sources, err
+	}
+	raw, rawSources, rawErr := genRawImage(opts, v, mediaDir, console, game)
+	if rawErr != nil {
+		return nil, nil, err
+	}
+	logger.Printf("Can't compose image for %s/%s (%s), using the plain artwork instead\n", console, game, err)
+	return raw, rawSources, nil
+}
+
+// genRawImage scales a game's artwork into the variant's box on an empty
+// canvas, without any backgrounds or effects.
+func genRawImage(opts *Options, v *Variant, mediaDir, console, game string) (image.Image, []string, error) {
+	artwork, src, err := findGameArtwork(opts, mediaDir, console, game)
+	if err != nil {
+		return nil, nil, err
+	}
+	b := artwork.Bounds()
+	w, h, posX, posY := opts.fitLayout(b.Dx(), b.Dy(), opts.safeBox(v.Layout))
+	scaled := scaleImage(opts, artwork, w, h, opts.scalerFor(b.Dx(), b.Dy(), w, h))
+	img := opts.newImage(image.Rect(0, 0, opts.CanvasW, opts.CanvasH))
+	draw.Copy(img, image.Point{posX, posY}, scaled, scaled.Bounds(), draw.Src, nil)
+	return img, []string{src}, nil
+}
+
+// composeImage places a game's artwork in the variant's box on a new canvas.
+func composeImage(opts *Options, v *Variant, mediaDir, console, game string) (draw.RGBA64Image, []string, error) {
+	box := opts.safeBox(v.Layout)
+	artwork, src, err := loadGameArtwork(opts, mediaDir, console, game, box.BoxW, box.BoxH)
+	if err != nil {
+		return nil, nil, err
+	}
+	var sources []string
+	if len(src) > 0 {
+		sources = append(sources, src)
+	}
+	return composeArtwork(opts, v, artwork, console, game), sources, nil
+}
+
+// composeArtwork places artwork in the variant's box on a new canvas.
+func composeArtwork(opts *Options, v *Variant, artwork image.Image, console, game string) draw.RGBA64Image {
+	box := opts.safeBox(v.Layout)
+	img, r := drawArtwork(opts, v, artwork)
+	opts.LayoutReport.record(console, game, v, artwork.Bounds(), r)
+	if opts.WarnAspect > 0 {
+		coverage := float64(r.Dx()*r.Dy()) / float64(box.BoxW*box.BoxH)
+		if coverage < opts.WarnAspect {
+			b := artwork.Bounds()
+			logger.Printf("Artwork for %s/%s covers only %.0f%% of the box (source is %dx%d); wrong kind of artwork?\n", console, game, coverage*100, b.Dx(), b.Dy())
+		}
+	}
+	return img
+}
+
+// drawArtwork draws artwork into the variant's box on a new canvas, with
+// its border. It returns the canvas and the rectangle covered by the
+// artwork.
+func drawArtwork(opts *Options, v *Variant, artwork image.Image) (draw.RGBA64Image, image.Rectangle) {
+	box := opts.safeBox(v.Layout)
+	img := newArtCanvas(opts)
+	r := placeArtwork(opts, img, artwork, box)
+	if opts.BorderWidth > 0 {
+		border := r
+		if opts.BorderAroundBox {
+			border = boxRect(box)
+		}
+		opts.drawArtBorder(img, border)
+	}
+	return img, r
+}
+
+// readListFile returns all lines of a file that are neither empty nor
+// comments starting with '#'.
+func readListFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// ignoreFileName is the name of the per-console file listing glob patterns
+// of ROMs to skip.
+const ignoreFileName = ".artgenignore"
+
+// loadIgnorePatterns reads the ignore file in romDir, if there is one, and
+// validates its patterns.
+func loadIgnorePatterns(romDir string) ([]string, error) {
+	path := filepath.Join(romDir, ignoreFileName)
+	if !fileExists(path) {
+		return nil, nil
+	}
+	patterns, err := readListFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range patterns {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("%s: invalid pattern %q", path, p)
+		}
+	}
+	return patterns, nil
+}
+
+// isIgnored reports whether filename matches any of the patterns.
+func isIgnored(patterns []string, filename string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, filename); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// gameList is a set of game names or ROM filenames that keeps track of
+// which entries were matched.
+type gameList map[string]bool
+
+func newGameList(entries []string) gameList {
+	l := make(gameList)
+	for _, e := range entries {
+		l[e] = false
+	}
+	return l
+}
+
+// match reports whether the ROM filename or its game name is in the list,
+// and marks the entry as found.
+func (l gameList) match(filename, game string) bool {
+	for _, k := range []string{filename, game} {
+		if _, ok := l[k]; ok {
+			l[k] = true
+			return true
+		}
+	}
+	return false
+}
+
+// unmatched returns all entries that were never matched.
+func (l gameList) unmatched() []string {
+	var res []string
+	for k, found := range l {
+		if !found {
+			res = append(res, k)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// readPlaylist returns the game names of all entries in an .m3u playlist.
+func readPlaylist(path string) ([]string, error) {
+	lines, err := readListFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var games []string
+	for _, line := range lines {
+		filename := filepath.Base(filepath.FromSlash(line))
+		games = append(games, strings.TrimSuffix(filename, filepath.Ext(filename)))
+	}
+	return games, nil
+}
+
+// genPlaylistImage tiles the artwork of all games into the artwork box,
+// and decorates the result like any image of the playlist's name.
+// Games without artwork get a placeholder tile.
+func genPlaylistImage(opts *Options, v *Variant, mediaDir, console, name string, games []string) (image.Image, []string, error) {
+	if len(games) == 0 {
+		return nil, nil, errors.New("Empty playlist")
+	}
+	cols := opts.PlaylistColumns
+	if cols < 1 {
+		cols = 1
+	}
+	if cols > len(games) {
+		cols = len(games)
+	}
+	rows := (len(games) + cols - 1) / cols
+	box := opts.safeBox(v.Layout)
+	spacing := opts.PlaylistSpacing
+	cellW := (box.BoxW - (cols-1)*spacing) / cols
+	cellH := (box.BoxH - (rows-1)*spacing) / rows
+	if cellW < 1 || cellH < 1 {
+		return nil, nil, fmt.Errorf("Too many games (%d) to tile into the artwork box", len(games))
+	}
+
+	img := newArtCanvas(opts)
+	var sources []string
+	for i, game := range games {
+		cellX := box.BoxX + (i%cols)*(cellW+spacing)
+		cellY := box.BoxY + (i/cols)*(cellH+spacing)
+
+		artwork, src, err := findGameArtwork(opts, mediaDir, console, game)
+		if err != nil {
+			logger.Printf("No artwork for playlist entry %s/%s: %s\n", console, game, err)
+			draw.Draw(img, image.Rect(cellX, cellY, cellX+cellW, cellY+cellH), image.NewUniform(placeholderColor), image.Point{}, draw.Src)
+			continue
+		}
+		sources = append(sources, src)
+
+		r := placeArtwork(opts, img, artwork, LayoutOpts{cellX, cellY, cellW, cellH})
+		if opts.BorderWidth > 0 && !opts.BorderAroundBox {
+			opts.drawArtBorder(img, r)
+		}
+	}
+	if len(sources) == 0 {
+		return nil, nil, errors.New("No artwork found for any playlist entry")
+	}
+	if opts.BorderWidth > 0 && opts.BorderAroundBox {
+		drawBorder(img, boxRect(box), opts.BorderWidth, opts.BorderColor)
+	}
+	res, err := decorateImage(opts, img, console, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, sources, nil
+}
+
+// outputDir returns the directory the images for console are written to.
+func outputDir(opts *Options, console string) string {
+	root := opts.RomDir
+	if len(opts.OutputRoot) > 0 {
+		root = opts.OutputRoot
+	}
+	return filepath.Join(root, console, opts.ImgDir)
+}
+
+// isValidImage reports whether path contains a complete image of the
+// expected size, or of any size if w is 0.
+func isValidImage(path string, w, h int) bool {
+	img, err := loadImageFile(path)
+	if err != nil {
+		return false
+	}
+	return w == 0 || img.Bounds().Dx() == w && img.Bounds().Dy() == h
+}
+
+// romFiles returns the names of all ROM files of console in romDir that
+// are neither junk nor ignored, in directory order.
+func romFiles(opts *Options, romDir, console string) ([]string, error) {
+	files, err := ioutil.ReadDir(romDir)
+	if err != nil {
+		return nil, err
+	}
+	ignored, err := loadIgnorePatterns(romDir)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, file := range files {
+		filename := file.Name()
+		if file.IsDir() || filename == ignoreFileName || filename == gamelistFileName || filename == checksumsFileName || isIgnored(ignored, filename) {
+			continue
+		}
+		if !opts.IncludeHidden && isJunkFile(filename) {
+			continue
+		}
+		if !opts.isRomFile(console, filename) {
+			continue
+		}
+		res = append(res, filename)
+	}
+	return res, nil
+}
+
+func genImages(opts *Options, folder string) (int, error) {
+	romDir := filepath.Join(opts.RomDir, folder)
+	console := opts.consoleName(folder)
+	opts = opts.forConsole(console).withConsoleBackground(console)
+	targetDir := outputDir(opts, console)
+
+	files, err := romFiles(opts, romDir, console)
+	if err != nil {
+		return 0, err
+	}
+	if len(files) == 0 {
+		logger.Printf("%s: no ROMs found in %s\n", console, romDir)
+		if !opts.KeepEmpty {
+			return 0, nil
+		}
+	}
+
+	sets := opts.outputSets()
+	for _, set := range sets {
+		dir := filepath.Join(targetDir, set.subdir)
+		if opts.Clean && !opts.Diff {
+			for _, d := range shardDirs(dir) {
+				cleanConsoleDir(d, romDir, console)
+			}
+		}
+		created, err := mkdirAll(dir)
+		if err != nil {
+			return 0, fmt.Errorf("Can't create output directory: %w", err)
+		}
+		if len(created) > 0 && !opts.KeepEmpty {
+			// Only keep directories we created if something was written.
+			defer removeEmptyDirs(dir, created)
+		}
+	}
+	var heroes string
+	if opts.Hero {
+		heroes = heroDir(opts, console)
+		created, err := mkdirAll(heroes)
+		if err != nil {
+			return 0, fmt.Errorf("Can't create output directory: %w", err)
+		}
+		if len(created) > 0 && !opts.KeepEmpty {
+			defer removeEmptyDirs(heroes, created)
+		}
+	}
+	var wheels string
+	if opts.Wheel {
+		wheels = wheelDir(opts, console)
+		created, err := mkdirAll(wheels)
+		if err != nil {
+			return 0, fmt.Errorf("Can't create output directory: %w", err)
+		}
+		if len(created) > 0 && !opts.KeepEmpty {
+			defer removeEmptyDirs(wheels, created)
+		}
+	}
+	var localFavorites favorites
+	if opts.FavoritesOnly {
+		if localFavorites, err = loadGamelistFavorites(romDir); err != nil {
+			return 0, fmt.Errorf("Can't read %s: %w", gamelistFileName, err)
+		}
+	}
+
+	marked := make(map[string]bool)
+	failed := 0
+	numFavorites := 0
+	favoritesNoArt := make(map[string]bool)
+	notInDat := 0
+	invalid := 0
+	var index []indexEntry
+	suggestions := make(suggester)
+	addToIndex := func(game, name string) {
+		if !opts.IndexJSON {
+			return
+		}
+		path := filepath.Join(targetDir, name)
+		e, err := newIndexEntry(game, filepath.ToSlash(name), path)
+		if err != nil {
+			logger.Printf("Can't add %s to index: %s\n", path, err)
+			return
+		}
+		index = append(index, e)
+	}
+	diff := newOutputDiff()
+	sums := make(checksums)
+	addChecksums := func(name string) {
+		if !opts.Checksums {
+			return
+		}
+		if err := sums.add(targetDir, name); err != nil {
+			logger.Printf("Can't compute checksum of %s: %s\n", filepath.Join(targetDir, name), err)
+		}
+		for level := 1; level <= opts.Mipmaps; level++ {
+			if mip := mipmapName(name, level); fileExists(filepath.Join(targetDir, mip)) {
+				if err := sums.add(targetDir, mip); err != nil {
+					logger.Printf("Can't compute checksum of %s: %s\n", filepath.Join(targetDir, mip), err)
+				}
+			}
+		}
+	}
+	start := time.Now()
+	for i, filename := range files {
+		if opts.MaxDurationPerConsole > 0 && time.Since(start) > opts.MaxDurationPerConsole {
+			logger.Printf("%s: stopped after %s, %d of %d ROMs were processed\n", console, opts.MaxDurationPerConsole, i, len(files))
+			break
+		}
+		game := strings.TrimSuffix(filename, filepath.Ext(filename))
+		if opts.Games != nil && !opts.Games.match(filename, game) {
+			continue
+		}
+		if opts.FavoritesOnly {
+			if !opts.isFavorite(localFavorites, console, filename, game) {
+				continue
+			}
+			numFavorites++
+		}
+		if opts.Dat != nil {
+			if _, ok := opts.Dat[game]; !ok {
+				logger.Printf("%s/%s not found in any DAT\n", console, filename)
+				notInDat++
+			}
+		}
+		var playlist []string
+		isPlaylist := opts.PlaylistCollage && strings.EqualFold(filepath.Ext(filename), ".m3u")
+		if isPlaylist {
+			if playlist, err = readPlaylist(filepath.Join(romDir, filename)); err != nil {
+				opts.report(console, game, StatusFailed, fmt.Errorf("Can't read playlist: %w", err))
+				failed++
+				continue
+			}
+		}
+
+		// All variants of a game share the decoded artwork.
+		opts.art = make(artCache)
+		for _, set := range sets {
+			set.opts.art = opts.art
+			for i := range set.opts.Variants {
+				v := &set.opts.Variants[i]
+				o := set.opts.forVariant(v)
+				expectedW, expectedH := o.expectedSize()
+				name := filepath.Join(set.subdir, o.shardedName(outputName(o, console, game, v)))
+				fileName := name + o.Format.Ext
+				targetName := filepath.Join(targetDir, fileName)
+				diff.seen[targetName] = true
+				for level := 1; level <= o.Mipmaps; level++ {
+					diff.seen[mipmapName(targetName, level)] = true
+				}
+				if o.Animated {
+					diff.seen[animatedName(targetName)] = true
+				}
+				if o.State != nil && o.State.upToDate(targetName) {
+					o.report(console, name, StatusSkipped, nil)
+					addToIndex(game, fileName)
+					addChecksums(fileName)
+					continue
+				}
+				if o.SkipExisting && fileExists(targetName) {
+					switch {
+					case o.VerifyExisting && !isValidImage(targetName, expectedW, expectedH):
+						logger.Printf("Existing image %s is invalid, regenerating\n", targetName)
+						invalid++
+					case o.MinVersion > 0 && imageRenderVersion(targetName) < o.MinVersion:
+						logger.Printf("Existing image %s was rendered by an older version, regenerating\n", targetName)
+					default:
+						o.report(console, name, StatusSkipped, nil)
+						addToIndex(game, fileName)
+						addChecksums(fileName)
+						continue
+					}
+				}
+
+				mediaDir := v.consoleMediaDir(console, opts.Aliases)
+				var img image.Image
+				var sources []string
+				if isPlaylist {
+					img, sources, err = genPlaylistImage(o, v, mediaDir, console, game, playlist)
+					if len(sources) < len(playlist) {
+						// Some games had no artwork, so don't consider this
+						// image final.
+						sources = nil
+					} else {
+						sources = append(sources, filepath.Join(romDir, filename))
+					}
+				} else {
+					img, sources, err = genImageWithFallback(o, v, mediaDir, console, game)
+				}
+				if err != nil && errors.Is(err, errNoArtwork) && o.NoArtOK.match(filename, game) {
+					continue
+				}
+				if err != nil {
+					if opts.FavoritesOnly && errors.Is(err, errNoArtwork) {
+						favoritesNoArt[game] = true
+					}
+					o.report(console, name, StatusFailed, err)
+					if o.Suggest && errors.Is(err, errNoArtwork) {
+						if f := suggestions.closest(mediaDir, game); len(f) > 0 {
+							logger.Printf("No art for %s/%s; closest: %s\n", console, game, f)
+						}
+					}
+					failed++
+					continue
+				}
+				img = finishImage(o, img)
+				encode := o.imageEncoder(sources)
+				if o.Diff {
+					if err := diff.compare(targetName, img, encode); err != nil {
+						o.report(console, name, StatusFailed, err)
+						failed++
+					}
+					continue
+				}
+				if o.ShardByLetter {
+					if err := os.MkdirAll(filepath.Dir(targetName), 0755); err != nil {
+						o.report(console, name, StatusFailed, fmt.Errorf("%w %s: %w", errWrite, targetName, err))
+						failed++
+						continue
+					}
+				}
+				if err = o.writeImage(targetName, img, encode); err != nil {
+					o.report(console, name, StatusFailed, err)
+					failed++
+					if errors.Is(err, errBudgetExceeded) {
+						return failed, err
+					}
+					continue
+				}
+				if o.Mipmaps > 0 {
+					if err := writeMipmaps(o, targetName, img, encode); err != nil {
+						o.report(console, name, StatusFailed, err)
+						failed++
+						if errors.Is(err, errBudgetExceeded) {
+							return failed, err
+						}
+						continue
+					}
+				}
+				dirs := []string{filepath.Dir(targetName)}
+				if o.ShardByLetter {
+					// The index and checksums are written next to the shards.
+					dirs = append(dirs, filepath.Dir(dirs[0]))
+				}
+				for _, dir := range dirs {
+					if !marked[dir] {
+						if err := markManaged(dir); err != nil {
+							logger.Printf("Can't mark %s as output directory: %s\n", dir, err)
+						}
+						marked[dir] = true
+					}
+				}
+				if o.PostCmd != nil {
+					if err := runPostCmd(o.PostCmd, targetName); err != nil {
+						logger.Printf("Post-processing %s failed: %s\n", targetName, err)
+					}
+				}
+				if o.Animated && len(sources) == 1 {
+					path := animatedName(targetName)
+					ok, err := genAnimated(o, v, sources[0], console, game, path)
+					switch {
+					case err != nil:
+						logger.Printf("Can't generate animated preview for %s/%s: %s\n", console, name, err)
+						o.ErrorLog.record(console, name+animatedExt, err)
+						failed++
+						if errors.Is(err, errBudgetExceeded) {
+							return failed, err
+						}
+					case ok:
+						logger.Printf("Created animated preview for %s/%s in %s\n", console, name, path)
+					}
+				}
+				if o.State != nil {
+					o.State.record(targetName, sources)
+				}
+				o.report(console, name, StatusCreated, nil)
+				addToIndex(game, fileName)
+				addChecksums(fileName)
+			}
+		}
+
+		if opts.Hero && !isPlaylist && !opts.Diff {
+			mediaDir := opts.Variants[0].consoleMediaDir(console, opts.Aliases)
+			path, err := genHero(opts, mediaDir, heroes, console, game)
+			switch {
+			case errors.Is(err, errBudgetExceeded):
+				return failed + 1, err
+			case errors.Is(err, errNoArtwork):
+				// Already reported for the main image.
+			case err != nil:
+				logger.Printf("Can't generate hero image for %s/%s: %s\n", console, game, err)
+				opts.ErrorLog.record(console, filepath.Join(opts.HeroDir, game), err)
+				failed++
+			case len(path) > 0:
+				logger.Printf("Created hero image for %s/%s in %s\n", console, game, path)
+			}
+		}
+		if opts.Wheel && !isPlaylist && !opts.Diff {
+			mediaDir := opts.WheelMedia.consoleMediaDir(console, opts.Aliases)
+			path, err := genWheel(opts, mediaDir, wheels, console, game)
+			switch {
+			case errors.Is(err, errBudgetExceeded):
+				return failed + 1, err
+			case errors.Is(err, errNoArtwork):
+				logger.Printf("No logo for %s/%s in %s\n", console, game, mediaDir)
+			case err != nil:
+				logger.Printf("Can't generate wheel logo for %s/%s: %s\n", console, game, err)
+				opts.ErrorLog.record(console, filepath.Join(opts.WheelDir, game), err)
+				failed++
+			case len(path) > 0:
+				logger.Printf("Created wheel logo for %s/%s in %s\n", console, game, path)
+			}
+		}
+	}
+	opts.art = nil
+	if opts.Diff {
+		removed := 0
+		for _, set := range sets {
+			for _, dir := range shardDirs(filepath.Join(targetDir, set.subdir)) {
+				for _, path := range diff.removed(dir) {
+					logger.Printf("Would not write %s\n", path)
+					removed++
+				}
+			}
+		}
+		logger.Printf("%s: %d added, %d changed, %d unchanged, %d without ROM\n", console, diff.added, diff.changed, diff.unchanged, removed)
+	}
+	if opts.Checksums && !opts.Diff && (len(sums) > 0 || opts.KeepEmpty) {
+		sumsName := filepath.Join(targetDir, checksumsFileName)
+		if err := sums.save(opts.Budget, sumsName); err != nil {
+			logger.Printf("Can't write checksums %s: %s\n", sumsName, err)
+			failed++
+		}
+	}
+	if opts.IndexJSON && !opts.Diff && (len(index) > 0 || opts.KeepEmpty) {
+		indexName := filepath.Join(targetDir, indexFileName(console))
+		if err := writeIndex(opts.Budget, indexName, index); err != nil {
+			logger.Printf("Can't write index %s: %s\n", indexName, err)
+			failed++
+		}
+	}
+	if opts.FavoritesOnly {
+		logger.Printf("%s: %d favorites, %d without artwork\n", console, numFavorites, len(favoritesNoArt))
+	}
+	if notInDat > 0 {
+		logger.Printf("%s: %d ROMs not found in any DAT\n", console, notInDat)
+	}
+	if invalid > 0 {
+		logger.Printf("%s: %d existing images were invalid and got regenerated\n", console, invalid)
+	}
+	return failed, nil
+}
+
+// genSingleImage generates the main image for one game and writes it to out,
+// which is either a file name or "-" for stdout.
+func genSingleImage(opts *Options, console, game, out string) error {
+	opts = opts.forConsole(console).withConsoleBackground(console)
+	v := &opts.Variants[0]
+	mediaDir := v.consoleMediaDir(console, opts.Aliases)
+	img, sources, err := genImageWithFallback(opts, v, mediaDir, console, game)
+	if err != nil {
+		return err
+	}
+	img = finishImage(opts, img)
+	encode := opts.imageEncoder(sources)
+	if out == "-" {
+		return encode(os.Stdout, img)
+	}
+	if len(out) == 0 {
+		out = filepath.Join(outputDir(opts, console), opts.shardedName(outputName(opts, console, game, v))+opts.Format.Ext)
+		if _, err := mkdirAll(filepath.Dir(out)); err != nil {
+			return fmt.Errorf("Can't create output directory: %w", err)
+		}
+	}
+	if err = opts.writeImage(out, img, encode); err != nil {
+		return err
+	}
+	if opts.PostCmd != nil {
+		if err := runPostCmd(opts.PostCmd, out); err != nil {
+			logger.Printf("Post-processing %s failed: %s\n", out, err)
+		}
+	}
+	logger.Printf("Created image for %s/%s in %s", console, game, out)
+	return nil
+}
+
+// saveReports writes the layout report and the error log, if requested.
+func saveReports(opts *Options) {
+	if opts.LayoutReport != nil {
+		if err := opts.LayoutReport.save(); err != nil {
+			logger.Printf("Can't write layout report %s: %s\n", opts.LayoutReport.path, err)
+		}
+	}
+	if opts.ErrorLog != nil {
+		if err := opts.ErrorLog.save(); err != nil {
+			logger.Printf("Can't write error log %s: %s\n", opts.ErrorLog.path, err)
+		}
+	}
+}
+
+// configError reports a fatal configuration problem and exits.
+func configError(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format, args...)
+	exit(exitConfigError)
+}
+
+// exit cleans up what outlives single images, such as the temporary files
+// of archives, and exits with code. Deferred calls don't run on os.Exit.
+func exit(code int) {
+	closeArtArchives()
+	os.Exit(code)
+}
+
+func main() {
+	defer closeArtArchives()
+	flag.Parse()
+
+	if len(*flagTheme) > 0 {
+		if err := applyTheme(*flagTheme); err != nil {
+			configError("Can't load theme %s: %s\n", *flagTheme, err)
+		}
+	}
+
+	if *flagVersion {
+		fmt.Printf("rg35xx-artgen render version %d\n", renderVersion)
+		return
+	}
+
+	if len(*flagDetect) > 0 {
+		l, err := detectLayout(*flagDetect)
+		if err != nil {
+			configError("Can't detect layout of %s: %s\n", *flagDetect, err)
+		}
+		printDetected(os.Stdout, l)
+		return
+	}
+
+	if len(*flagRomDir) == 0 && len(*flagImagesDir) == 0 {
+		configError("--rom_dir not set!\n")
+	}
+	if len(*flagGame) > 0 && len(*flagConsole) == 0 {
+		configError("--game requires --console!\n")
+	}
+
+	mediaDir := filepath.Join(*flagRomDir, *flagMediaDir)
+	mediaMap, err := parseMap(*flagMediaMap)
+	if err != nil {
+		configError("Invalid --media_map: %s\n", err)
+	}
+	consoleMap, err := parseMap(*flagConsoleMap)
+	if err != nil {
+		configError("Invalid --console_map: %s\n", err)
+	}
+	romExts, err := parseRomExts(*flagRomExts)
+	if err != nil {
+		configError("Invalid --rom_exts: %s\n", err)
+	}
+	for console, exts := range defaultRomExts {
+		if _, ok := romExts[console]; !ok {
+			romExts[console] = exts
+		}
+	}
+	priorities, err := parsePriorities(*flagPriority)
+	if err != nil {
+		configError("Invalid --priority: %s\n", err)
+	}
+	matchTiers, err := parseMatchTiers(*flagMatchTiers)
+	if err != nil {
+		configError("Invalid --match_tiers: %s\n", err)
+	}
+	extraAliases, err := parseMap(*flagConsoleAliases)
+	if err != nil {
+		configError("Invalid --console_aliases: %s\n", err)
+	}
+	var scraper *scraperProfile
+	if len(*flagScraper) > 0 {
+		p, ok := scraperProfiles[*flagScraper]
+		if !ok {
+			configError("Unknown --scraper %q, expected one of %s\n", *flagScraper, strings.Join(scraperNames(), ", "))
+		}
+		scraper = &p
+	}
+	variants := []Variant{{MediaDir: mediaDir, MediaMap: mediaMap, Layout: defaultLayout}}
+	if scraper != nil {
+		variants[0].MediaTemplate = scraper.mediaTemplate(*flagRomDir, "")
+	}
+	for _, v := range flagVariants {
+		switch {
+		case len(v.MediaDir) > 0:
+			v.MediaDir = filepath.Join(*flagRomDir, v.MediaDir)
+		case scraper != nil:
+			v.MediaTemplate = scraper.mediaTemplate(*flagRomDir, v.MediaKind)
+		default:
+			v.MediaDir = mediaDir
+		}
+		if len(v.MediaKind) > 0 && scraper == nil {
+			configError("Variant %s: kind requires --scraper\n", v.Suffix)
+		}
+		variants = append(variants, v)
+	}
+
+	opts := &Options{
+		RomDir:           *flagRomDir,
+		MameExtrasDir:    *flagMameExtrasDir,
+		ConsoleMap:       consoleMap,
+		Aliases:          newConsoleAliases(extraAliases),
+		RomExts:          romExts,
+		MatchTiers:       matchTiers,
+		Verbose:          *flagVerbose,
+		OutputRoot:       *flagOutputRoot,
+		ImgDir:           *flagImgDir,
+		ShardByLetter:    *flagShardByLetter,
+		NameHash:         *flagNameHash,
+		NameTemplate:     *flagNameTemplate,
+		CanvasW:          screenW,
+		CanvasH:          screenH,
+		Variants:         variants,
+		IncludeHidden:    *flagIncludeHidden,
+		Quality:          *flagQuality,
+		PrescaleMax:      *flagPrescaleMax,
+		WarnAspect:       *flagWarnAspect,
+		Suggest:          *flagSuggest,
+		AdaptiveScaler:   *flagAdaptiveScaler,
+		PreferLargest:    *flagPreferLargest,
+		UpscaleThreshold: *flagUpscaleThreshold,
+		Flatten:          *flagFlatten,
+		BorderWidth:      *flagBorderWidth,
+		Animated:         *flagAnimated,
+		SkipExisting:     *flagSkipExisting || *flagVerifyExisting,
+		MinVersion:       *flagMinVersion,
+		Mipmaps:          *flagMipmaps,
+		VerifyExisting:   *flagVerifyExisting,
+		Atomic:           *flagAtomic,
+		Clean:            *flagClean,
+		Diff:             *flagDiff,
+
+		MaxDurationPerConsole: *flagMaxDuration,
+		KeepEmpty:             *flagKeepEmpty,
+		IndexJSON:             *flagIndexJSON,
+		Checksums:             *flagChecksums,
+		Placeholder:           *flagPlaceholder || len(*flagPlaceholderArt) > 0,
+		FallbackRaw:           *flagFallbackRaw,
+		PlaylistCollage:       *flagPlaylistCollage,
+		PlaylistColumns:       *flagPlaylistColumns,
+		PlaylistSpacing:       *flagPlaylistSpacing,
+	}
+
+	opts.Progress = logProgress(opts)
+	opts.titles = newTitleIndex()
+
+	if len(*flagOutputAspect) > 0 {
+		aspect, err := parseAspect(*flagOutputAspect)
+		if err != nil {
+			configError("Invalid --output_aspect %q: %s\n", *flagOutputAspect, err)
+		}
+		opts.CanvasH = int(math.Round(float64(opts.CanvasW) / aspect))
+		if opts.CanvasH < 1 {
+			configError("Invalid --output_aspect %q: too wide\n", *flagOutputAspect)
+		}
+		for i := range opts.Variants {
+			if opts.Variants[i].Size.W == 0 {
+				opts.Variants[i].Layout = opts.Variants[i].Layout.scaled(1, float64(opts.CanvasH)/screenH)
+			}
+		}
+	}
+
+	if len(*flagOutputSize) > 0 {
+		if len(*flagOutputAspect) > 0 {
+			configError("--output_size and --output_aspect are mutually exclusive\n")
+		}
+		w, h, err := parseSize(*flagOutputSize)
+		if err != nil {
+			configError("Invalid --output_size %q: %s\n", *flagOutputSize, err)
+		}
+		opts.CanvasW, opts.CanvasH = w, h
+		for i := range opts.Variants {
+			if opts.Variants[i].Size.W == 0 {
+				opts.Variants[i].Layout = opts.Variants[i].Layout.scaled(float64(w)/screenW, float64(h)/screenH)
+			}
+		}
+	}
+	if len(*flagScreenAnchor) > 0 {
+		if !isScreenAnchor(*flagScreenAnchor) {
+			configError("Invalid --screen_anchor %q, expected one of %s\n", *flagScreenAnchor, strings.Join(screenAnchors, ", "))
+		}
+		if *flagScreenMargin < 0 || 2**flagScreenMargin >= minInt(opts.CanvasW, opts.CanvasH) {
+			configError("Invalid --screen_margin %d: must not be negative and leave room for the artwork\n", *flagScreenMargin)
+		}
+		opts.ScreenAnchor = *flagScreenAnchor
+		for i := range opts.Variants {
+			v := &opts.Variants[i]
+			w, h := opts.CanvasW, opts.CanvasH
+			if v.Size.W > 0 {
+				w, h = v.Size.W, v.Size.H
+			}
+			v.Layout = v.Layout.anchored(opts.ScreenAnchor, *flagScreenMargin, w, h)
+		}
+	}
+	switch opts.Quality {
+	case qualityFast, qualityGood, qualityBest:
+	default:
+		configError("Invalid --quality %q, expected \"fast\", \"good\", or \"best\"\n", opts.Quality)
+	}
+	if len(*flagMinSource) > 0 {
+		w, h, err := parseSize(*flagMinSource)
+		if err != nil {
+			configError("Invalid --min_source %q: %s\n", *flagMinSource, err)
+		}
+		opts.MinSource = canvasSize{w, h}
+		opts.MinSourceWarn = *flagMinSourceWarn
+	}
+	if *flagAlphaThreshold < 0 || *flagAlphaThreshold > 255 {
+		configError("Invalid --alpha_threshold %d: must be between 0 and 255\n", *flagAlphaThreshold)
+	}
+	if *flagAlphaFloor < 0 || *flagAlphaFloor > 255 {
+		configError("Invalid --alpha_floor %d: must be between 0 and 255\n", *flagAlphaFloor)
+	}
+	opts.AlphaThreshold = uint8(*flagAlphaThreshold)
+	opts.AlphaFloor = uint8(*flagAlphaFloor)
+
+	if *flagAtlas {
+		if !isPowerOfTwo(*flagAtlasMax) {
+			configError("Invalid --atlas_max %d: must be a power of two\n", *flagAtlasMax)
+		}
+		if l := opts.Variants[0].Layout; l.BoxW > *flagAtlasMax || l.BoxH > *flagAtlasMax {
+			configError("--atlas_max %d is smaller than the artwork box %dx%d\n", *flagAtlasMax, l.BoxW, l.BoxH)
+		}
+		if len(*flagSystemBanners) > 0 {
+			configError("--atlas and --system_banners are mutually exclusive\n")
+		}
+		if *flagDiff {
+			configError("--diff does not support --atlas\n")
+		}
+		opts.Atlas = true
+		opts.AtlasMax = *flagAtlasMax
+	}
+	if len(*flagSystemBanners) > 0 {
+		if *flagDiff {
+			configError("--diff does not support --system_banners\n")
+		}
+		if *flagBannerPick != "first" && *flagBannerPick != "random" {
+			configError("Invalid --banner_pick %q, expected \"first\" or \"random\"\n", *flagBannerPick)
+		}
+		bannerGames, err := parseMap(*flagBannerGames)
+		if err != nil {
+			configError("Invalid --banner_games: %s\n", err)
+		}
+		opts.SystemBanners = *flagSystemBanners
+		opts.SystemLogos = *flagSystemLogos
+		opts.BannerPick = *flagBannerPick
+		opts.BannerGames = bannerGames
+	}
+
+	if !isAmbiguousPolicy(*flagOnAmbiguous) {
+		configError("Invalid --on_ambiguous %q, expected one of %s\n", *flagOnAmbiguous, strings.Join(ambiguousPolicies, ", "))
+	}
+	opts.OnAmbiguous = *flagOnAmbiguous
+	for _, region := range strings.Split(*flagRegionPriority, ",") {
+		if region = strings.TrimSpace(region); len(region) > 0 {
+			opts.RegionPriority = append(opts.RegionPriority, region)
+		}
+	}
+
+	if *flagUniformHeight < 0 {
+		configError("Invalid --uniform_height %d: must not be negative\n", *flagUniformHeight)
+	}
+	opts.UniformHeight = *flagUniformHeight
+	if *flagFillSnap < 0 {
+		configError("Invalid --fill_snap %d: must not be negative\n", *flagFillSnap)
+	}
+	opts.FillSnap = *flagFillSnap
+	if len(*flagUniformHeightConsoles) > 0 {
+		opts.UniformHeightConsoles = splitList(*flagUniformHeightConsoles)
+	}
+
+	if len(*flagCenterFull) > 0 {
+		if *flagCenterFullMax <= 0 || *flagCenterFullMax > 1 {
+			configError("Invalid --center_full_max %v: must be in (0, 1]\n", *flagCenterFullMax)
+		}
+		opts.CenterFull = splitList(*flagCenterFull)
+		opts.CenterFullMax = *flagCenterFullMax
+	}
+	if len(*flagSizes) > 0 {
+		for _, s := range strings.Split(*flagSizes, ",") {
+			w, h, err := parseSize(strings.TrimSpace(s))
+			if err != nil {
+				configError("Invalid --sizes %q: %s\n", *flagSizes, err)
+			}
+			opts.Sizes = append(opts.Sizes, canvasSize{w, h})
+		}
+	}
+	if len(*flagCrops) > 0 {
+		crops, err := parseCrops(*flagCrops)
+		if err != nil {
+			configError("Invalid --crops: %s\n", err)
+		}
+		if len(opts.Sizes) > 0 {
+			configError("--crops can't be combined with --sizes\n")
+		}
+		opts.Crops = crops
+	}
+	for _, v := range opts.Variants {
+		if v.Size.W > 0 && len(opts.Sizes) > 0 {
+			configError("Variant %s: size can't be combined with --sizes\n", v.Suffix)
+		}
+		if v.Size.W > 0 && len(opts.Crops) > 0 {
+			configError("Variant %s: size can't be combined with --crops\n", v.Suffix)
+		}
+	}
+	if *flagDPI < 0 {
+		configError("Invalid --dpi %v: must not be negative\n", *flagDPI)
+	}
+	opts.DPI = *flagDPI
+	if *flagVignette < 0 || *flagVignette > 1 {
+		configError("Invalid --vignette %v: must be between 0 and 1\n", *flagVignette)
+	}
+	opts.Vignette = *flagVignette
+	if *flagFeather < 0 {
+		configError("Invalid --feather %d: must not be negative\n", *flagFeather)
+	}
+	if *flagMaxDuration < 0 {
+		configError("Invalid --max_duration_per_console %s: must not be negative\n", *flagMaxDuration)
+	}
+	if *flagMipmaps < 0 {
+		configError("Invalid --mipmaps %d: must not be negative\n", *flagMipmaps)
+	}
+	opts.Feather = *flagFeather
+	opts.Tight = *flagTight
+	if *flagReflection < 0 || *flagReflection > 1 {
+		configError("Invalid --reflection %v: must be between 0 and 1\n", *flagReflection)
+	}
+	if *flagReflectionOpacity < 0 || *flagReflectionOpacity > 1 {
+		configError("Invalid --reflection_opacity %v: must be between 0 and 1\n", *flagReflectionOpacity)
+	}
+	opts.Reflection = *flagReflection
+	opts.ReflectionOpacity = *flagReflectionOpacity
+
+	if len(*flagFrontend) > 0 {
+		fe, ok := frontends[*flagFrontend]
+		if !ok {
+			configError("Unknown --frontend %q\n", *flagFrontend)
+		}
+		opts.ImgDir = fe.ImgDir
+		opts.NameTemplate = fe.NameTemplate
+	}
+	if opts.NameHash < 0 || opts.NameHash > 2*sha256.Size {
+		configError("Invalid --name_hash %d: must be between 0 and %d\n", opts.NameHash, 2*sha256.Size)
+	}
+
+	format, ok := imageFormats[normalizeFormat(*flagFormat)]
+	if !ok {
+		configError("Unknown --format %q\n", *flagFormat)
+	}
+	opts.Format = format
+	if *flagPNG16 && format.Name != "png" {
+		configError("--png_16bit requires --format png\n")
+	}
+	opts.PNG16 = *flagPNG16
+	if *flagEmbedMetadata {
+		if format.Name != "png" {
+			configError("--embed_metadata requires --format png\n")
+		}
+		var args []string
+		flag.Visit(func(f *flag.Flag) {
+			args = append(args, "--"+f.Name+"="+shellQuote(f.Value.String()))
+		})
+		opts.EmbedMetadata = true
+		opts.MetadataOptions = strings.Join(args, " ")
+	}
+
+	if len(*flagPostCmd) > 0 {
+		args, err := splitArgs(*flagPostCmd)
+		if err != nil || len(args) == 0 {
+			configError("Invalid --post_cmd %q: %v\n", *flagPostCmd, err)
+		}
+		if _, err := exec.LookPath(args[0]); err != nil {
+			configError("Invalid --post_cmd %q: %s\n", *flagPostCmd, err)
+		}
+		opts.PostCmd = args
+	}
+
+	if *flagMaxOutputBytes > 0 {
+		root := opts.OutputRoot
+		if len(root) == 0 {
+			root = opts.RomDir
+		}
+		opts.Budget = newOutputBudget(*flagMaxOutputBytes, root)
+	}
+
+	if len(*flagVideoFrame) > 0 {
+		f, err := parseVideoFrame(*flagVideoFrame)
+		if err != nil {
+			configError("Invalid --video_frame %q: %s\n", *flagVideoFrame, err)
+		}
+		if _, err := exec.LookPath(ffmpegBinary); err != nil {
+			configError("--video_frame requires %s: %s\n", ffmpegBinary, err)
+		}
+		opts.VideoFrame = f
+	}
+
+	if len(*flagBadges) > 0 {
+		if !badgeCorners[*flagBadgeCorner] {
+			configError("Invalid --badge_corner %q\n", *flagBadgeCorner)
+		}
+		badges, err := loadBadges(*flagBadges)
+		if err != nil {
+			configError("Can't load badges file %s: %s\n", *flagBadges, err)
+		}
+		opts.Badges = badges
+		opts.BadgeCorner = *flagBadgeCorner
+	}
+
+	if len(*flagPaletteFile) > 0 {
+		p, err := loadPalette(*flagPaletteFile)
+		if err != nil {
+			configError("Can't load palette file %s: %s\n", *flagPaletteFile, err)
+		}
+		opts.Palette = p
+		opts.Dither = *flagDither
+	}
+
+	if len(*flagBgColor) > 0 {
+		c, err := parseColor(*flagBgColor)
+		if err != nil {
+			configError("Invalid --bg_color: %s\n", err)
+		}
+		opts.BgColor = c
+	}
+
+	if opts.BorderWidth > 0 {
+		c, err := parseColor(*flagBorderColor)
+		if err != nil {
+			configError("Invalid --border_color: %s\n", err)
+		}
+		opts.BorderColor = c
+		switch *flagBorderAround {
+		case "art":
+		case "box":
+			opts.BorderAroundBox = true
+		default:
+			configError("Invalid --border_around %q, expected \"art\" or \"box\"\n", *flagBorderAround)
+		}
+	}
+	if *flagCornerRadius < 0 {
+		configError("Invalid --corner_radius %d: must not be negative\n", *flagCornerRadius)
+	}
+	if *flagAA < 1 || *flagAA > 16 {
+		configError("Invalid --aa %d: must be between 1 and 16\n", *flagAA)
+	}
+	opts.CornerRadius = *flagCornerRadius
+	opts.AA = *flagAA
+	if _, ok := blendFuncs[*flagBlend]; !ok && *flagBlend != "over" {
+		configError("Invalid --blend %q, expected over, multiply, screen, or add\n", *flagBlend)
+	}
+	opts.Blend = *flagBlend
+
+	if len(*flagLayers) > 0 {
+		layers, err := loadLayers(*flagLayers, opts.RomDir)
+		if err != nil {
+			configError("Can't load layers: %s\n", err)
+		}
+		opts.Layers = layers
+		if len(opts.Sizes) > 0 {
+			// Layer boxes are absolute and would not fit the other sizes.
+			configError("--layers can't be combined with --sizes\n")
+		}
+		if len(opts.Crops) > 0 {
+			configError("--layers can't be combined with --crops\n")
+		}
+	}
+
+	if len(*flagLayoutReport) > 0 {
+		opts.LayoutReport = &layoutReport{path: *flagLayoutReport}
+	}
+	if len(*flagErrorJSON) > 0 {
+		opts.ErrorLog = &errorLog{path: *flagErrorJSON}
+	}
+
+	if len(*flagState) > 0 {
+		state, err := loadState(*flagState)
+		if err != nil {
+			configError("Can't load state file %s: %s\n", *flagState, err)
+		}
+		opts.State = state
+	}
+
+	if len(*flagDB) > 0 {
+		db, err := openArtDB(*flagDB, *flagDBQuery)
+		if err != nil {
+			configError("Can't open database %s: %s\n", *flagDB, err)
+		}
+		opts.ArtDB = db
+	}
+
+	if len(*flagArtManifest) > 0 {
+		manifest, err := loadArtManifest(*flagArtManifest)
+		if err != nil {
+			configError("Can't load artwork manifest %s: %s\n", *flagArtManifest, err)
+		}
+		opts.ArtManifest = manifest
+	}
+
+	if len(*flagDat) > 0 {
+		dat, err := loadDats(strings.Split(*flagDat, ","))
+		if err != nil {
+			configError("Can't load DAT files: %s\n", err)
+		}
+		opts.Dat = dat
+	}
+	if len(*flagNameRules) > 0 {
+		rules, err := loadNameRules(*flagNameRules)
+		if err != nil {
+			configError("Can't load name rules %s: %s\n", *flagNameRules, err)
+		}
+		opts.NameRules = rules
+	}
+	if len(*flagParents) > 0 {
+		parents, err := loadParents(*flagParents)
+		if err != nil {
+			configError("Can't load parents file %s: %s\n", *flagParents, err)
+		}
+		opts.Parents = parents
+	}
+
+	if len(*flagGamesFile) > 0 {
+		games, err := readListFile(*flagGamesFile)
+		if err != nil {
+			configError("Can't read games file: %s\n", err)
+		}
+		opts.Games = newGameList(games)
+	}
+	if len(*flagFavorites) > 0 {
+		favs, err := loadFavorites(*flagFavorites)
+		if err != nil {
+			configError("Can't read favorites %s: %s\n", *flagFavorites, err)
+		}
+		opts.Favorites = favs
+	}
+	opts.FavoritesOnly = *flagFavoritesOnly
+	if len(*flagNoArtOK) > 0 {
+		games, err := readListFile(*flagNoArtOK)
+		if err != nil {
+			configError("Can't read no_art_ok file: %s\n", err)
+		}
+		opts.NoArtOK = newGameList(games)
+	}
+
+	if *flagHero {
+		if *flagHeroBlur < 0 {
+			configError("Invalid --hero_blur %d: must not be negative\n", *flagHeroBlur)
+		}
+		if *flagHeroDarken < 0 || *flagHeroDarken > 1 {
+			configError("Invalid --hero_darken %v: must be between 0 and 1\n", *flagHeroDarken)
+		}
+		opts.Hero = true
+		opts.HeroDir = *flagHeroDir
+		opts.HeroBlur = *flagHeroBlur
+		opts.HeroDarken = *flagHeroDarken
+	}
+	if *flagWheel {
+		if *flagWheelHeight <= 0 {
+			configError("Invalid --wheel_height %d: must be positive\n", *flagWheelHeight)
+		}
+		if opts.Format.Name == "jpg" {
+			configError("--wheel requires a format with transparency, not %s\n", opts.Format.Name)
+		}
+		opts.Wheel = true
+		opts.WheelDir = *flagWheelDir
+		opts.WheelHeight = *flagWheelHeight
+		switch {
+		case len(*flagWheelMedia) > 0:
+			opts.WheelMedia.MediaDir = filepath.Join(opts.RomDir, *flagWheelMedia)
+		case scraper != nil:
+			opts.WheelMedia.MediaTemplate = scraper.mediaTemplate(opts.RomDir, wheelKind)
+		default:
+			opts.WheelMedia.MediaDir = filepath.Join(mediaDir, wheelKind)
+		}
+	}
+
+	if len(*flagMockup) > 0 {
+		frame, err := loadImageFile(*flagMockup)
+		if err != nil {
+			configError("Can't load mockup %s: %s\n", *flagMockup, err)
+		}
+		screen, err := parseBox(*flagMockupScreen)
+		if err != nil {
+			configError("Invalid --mockup_screen: %s\n", err)
+		}
+		if !boxRect(screen).In(image.Rect(0, 0, frame.Bounds().Dx(), frame.Bounds().Dy())) {
+			configError("--mockup_screen %s is not within the %dx%d mockup\n", *flagMockupScreen, frame.Bounds().Dx(), frame.Bounds().Dy())
+		}
+		if len(opts.Sizes) > 0 {
+			configError("--mockup can't be combined with --sizes\n")
+		}
+		if len(opts.Crops) > 0 {
+			configError("--mockup can't be combined with --crops\n")
+		}
+		opts.Mockup = frame
+		opts.MockupScreen = screen
+	}
+
+	if len(*flagSafeInset) > 0 {
+		inset, err := parseInsets(*flagSafeInset)
+		if err != nil {
+			configError("Invalid --safe_inset %q: %s\n", *flagSafeInset, err)
+		}
+		opts.SafeInset = inset
+		if opts.safeRect().Empty() {
+			configError("--safe_inset %q leaves nothing of the %dx%d screen\n", *flagSafeInset, opts.CanvasW, opts.CanvasH)
+		}
+	}
+
+	if len(*flagBackground) > 0 {
+		img, err := loadImageFile(*flagBackground)
+		if err != nil {
+			configError("Can't load background %s: %s\n", *flagBackground, err)
+		}
+		opts.Background = img
+	}
+
+	if len(*flagPlaceholderArt) > 0 {
+		img, err := loadImageFile(*flagPlaceholderArt)
+		if err != nil {
+			configError("Can't load placeholder art %s: %s\n", *flagPlaceholderArt, err)
+		}
+		opts.PlaceholderArt = img
+	}
+
+	if len(*flagServe) > 0 {
+		if err := serve(opts, *flagServe); err != nil {
+			configError("Can't serve previews: %s\n", err)
+		}
+		return
+	}
+
+	if len(*flagGame) > 0 {
+		err := genSingleImage(opts, opts.consoleName(*flagConsole), *flagGame, *flagOut)
+		if err != nil {
+			opts.ErrorLog.record(opts.consoleName(*flagConsole), *flagGame, err)
+		}
+		saveReports(opts)
+		if err != nil {
+			logger.Printf("Can't generate image for %s/%s: %s\n", *flagConsole, *flagGame, err)
+			exit(exitFailures)
+		}
+		return
+	}
+
+	if len(*flagImagesDir) > 0 {
+		outDir := opts.OutputRoot
+		if len(outDir) == 0 {
+			outDir = filepath.Join(*flagImagesDir, opts.ImgDir)
+		}
+		if filepath.Clean(outDir) == filepath.Clean(*flagImagesDir) {
+			configError("--output_root must differ from --images_dir\n")
+		}
+		failed, err := genFromImagesDir(opts, *flagImagesDir, outDir)
+		saveReports(opts)
+		if err != nil {
+			configError("Can't read images from %s: %s\n", *flagImagesDir, err)
+		}
+		if failed > 0 && *flagFailOnError {
+			exit(exitFailures)
+		}
+		return
+	}
+
+	failed := 0
+	ignoredConsoles := defaultIgnoredConsoles
+	if !filepath.IsAbs(*flagMediaDir) {
+		// The media directory is inside --rom_dir.
+		top, _, _ := strings.Cut(filepath.ToSlash(filepath.Clean(*flagMediaDir)), "/")
+		ignoredConsoles = append(ignoredConsoles, strings.ToLower(top))
+	}
+	if len(*flagIgnoreConsoles) > 0 {
+		for _, p := range splitList(*flagIgnoreConsoles) {
+			ignoredConsoles = append(ignoredConsoles, strings.ToLower(strings.TrimSpace(p)))
+		}
+	}
+	consoles := expandConsoles(opts.RomDir, *flagConsoles, ignoredConsoles)
+	prioritize(consoles, priorities)
+	if *flagCoverage {
+		if writeCoverage(os.Stdout, opts, consoles) > 0 && *flagFailOnError {
+			exit(exitFailures)
+		}
+		return
+	}
+	if *flagVerifyExt || *flagFixExt {
+		bad := 0
+		for _, c := range consoles {
+			bad += verifyExtensions(opts, c, *flagFixExt)
+		}
+		logger.Printf("%d artwork files have the wrong extension or can't be decoded\n", bad)
+		if bad > 0 && *flagFailOnError {
+			exit(exitFailures)
+		}
+		return
+	}
+	for _, c := range consoles {
+		if len(opts.SystemBanners) > 0 {
+			if err := genSystemBanner(opts, c); err != nil {
+				logger.Printf("Can't generate banner for %s: %s\n", c, err)
+				failed++
+			}
+			continue
+		}
+		gen := genImages
+		if opts.Atlas {
+			gen = genAtlas
+		}
+		n, err := gen(opts, c)
+		if errors.Is(err, errBudgetExceeded) {
+			logger.Printf("Stopping: %s\n", err)
+			failed += n
+			break
+		}
+		if err != nil {
+			logger.Printf("Can't generate images for %s: %s\n", c, err)
+			n++
+		}
+		failed += n
+	}
+
+	if opts.State != nil {
+		if err := opts.State.save(); err != nil {
+			logger.Printf("Can't save state file %s: %s\n", *flagState, err)
+		}
+	}
+
+	saveReports(opts)
+
+	for _, g := range opts.Games.unmatched() {
+		logger.Printf("Listed game %s not found in any console\n", g)
+	}
+
+	if failed > 0 && *flagFailOnError {
+		exit(exitFailures)
 	}
+	exit(exitOK)
 }
@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// scraperProfile describes where a scraper stores the artwork it
+// downloaded.
+type scraperProfile struct {
+	// mediaDir is the directory holding the artwork of one kind for a
+	// console, relative to the ROM directory. "{console}" and "{kind}" are
+	// replaced by the console and the kind of artwork.
+	mediaDir string
+	// defaultKind is the kind of artwork used for the main image.
+	defaultKind string
+}
+
+// scraperProfiles are the scrapers --scraper knows, by name.
+var scraperProfiles = map[string]scraperProfile{
+	// Skraper with its default media folder settings.
+	"skraper": {
+		mediaDir:    filepath.Join("{console}", "media", "{kind}"),
+		defaultKind: "box2dfront",
+	},
+}
+
+// scraperNames returns the names of all scraper profiles, sorted.
+func scraperNames() []string {
+	var names []string
+	for name := range scraperProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// mediaTemplate returns the template of the media directories of a variant
+// showing kind, or the profile's default kind if kind is empty, with
+// "{console}" left to be replaced by consoleMediaDir.
+func (p scraperProfile) mediaTemplate(romDir, kind string) string {
+	if len(kind) == 0 {
+		kind = p.defaultKind
+	}
+	return filepath.Join(romDir, strings.ReplaceAll(p.mediaDir, "{kind}", kind))
+}
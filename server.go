@@ -0,0 +1,168 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// previewHandler renders images on demand for GET /{console}/{game}.{ext},
+// where ext selects the format. Query parameters named like the
+// corresponding flags override the options for a single request, e.g.
+// /gb/Tetris.png?box=300x300+20+90&bg_color=202020.
+type previewHandler struct {
+	opts *Options
+}
+
+func (h *previewHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	console, file, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if !ok || len(console) == 0 || len(file) == 0 || strings.Contains(file, "/") {
+		http.Error(w, "Expected /{console}/{game}.{ext}", http.StatusNotFound)
+		return
+	}
+	if !h.isConsole(console) {
+		http.Error(w, fmt.Sprintf("Unknown console %q", console), http.StatusNotFound)
+		return
+	}
+	ext := path.Ext(file)
+	format, ok := imageFormats[normalizeFormat(ext)]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown format %q", ext), http.StatusNotFound)
+		return
+	}
+	game := strings.TrimSuffix(file, ext)
+	if !isPathElem(game) {
+		http.Error(w, fmt.Sprintf("Invalid game %q", game), http.StatusNotFound)
+		return
+	}
+
+	opts := *h.opts.forConsole(console).withConsoleBackground(console)
+	opts.Format = format
+	v := opts.Variants[0]
+	if err := applyQuery(&opts, &v, r.URL.Query()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	img, _, err := genImage(&opts, &v, v.consoleMediaDir(console, opts.Aliases), console, game)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	var buf bytes.Buffer
+	if err = opts.encodeImage(&buf, finishImage(&opts, img)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", http.DetectContentType(buf.Bytes()))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(buf.Bytes())
+}
+
+// isPathElem reports whether s can safely be used as a single element of
+// a path, on any OS: it must neither be "." or "..", nor contain a
+// separator.
+func isPathElem(s string) bool {
+	return filepath.IsLocal(s) && s != "." && !strings.ContainsAny(s, `/\`)
+}
+
+// isConsole reports whether console names a ROM folder, or is what one is
+// mapped to. Anything else, such as "..", must not become part of a path.
+func (h *previewHandler) isConsole(console string) bool {
+	if !isPathElem(console) {
+		return false
+	}
+	entries, err := ioutil.ReadDir(h.opts.RomDir)
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		if e.IsDir() && (e.Name() == console || h.opts.consoleName(e.Name()) == console) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyQuery overrides options with the values of query parameters.
+func applyQuery(opts *Options, v *Variant, q url.Values) error {
+	for key, vals := range q {
+		val := vals[len(vals)-1]
+		var err error
+		switch key {
+		case "variant":
+			found := false
+			for _, variant := range opts.Variants {
+				if variant.Suffix == val {
+					*v = variant
+					found = true
+				}
+			}
+			if !found {
+				err = fmt.Errorf("Unknown variant %q", val)
+			}
+		case "box":
+			// An unescaped '+' in a query string turns into a space.
+			v.Layout, err = parseBox(strings.ReplaceAll(val, " ", "+"))
+		case "bg_color":
+			opts.BgColor, err = parseColor(val)
+		case "flatten":
+			opts.Flatten, err = strconv.ParseBool(val)
+		case "placeholder":
+			opts.Placeholder, err = strconv.ParseBool(val)
+		case "adaptive_scaler":
+			opts.AdaptiveScaler, err = strconv.ParseBool(val)
+		case "upscale_threshold":
+			opts.UpscaleThreshold, err = strconv.ParseFloat(val, 64)
+		case "border_width":
+			opts.BorderWidth, err = strconv.Atoi(val)
+		case "border_color":
+			opts.BorderColor, err = parseColor(val)
+		case "border_around":
+			opts.BorderAroundBox = val == "box"
+		default:
+			err = fmt.Errorf("Unknown option")
+		}
+		if err != nil {
+			return fmt.Errorf("Invalid %s=%q: %s", key, val, err)
+		}
+	}
+	if opts.BorderWidth > 0 && opts.BorderColor == nil {
+		opts.BorderColor = color.White
+	}
+	return nil
+}
+
+// serve runs the preview server on addr until it fails.
+func serve(opts *Options, addr string) error {
+	logger.Printf("Serving previews on %s, e.g. http://%s/gb/Tetris.png", addr, addr)
+	return http.ListenAndServe(addr, &previewHandler{opts})
+}
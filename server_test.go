@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPreviewHandlerRejectsUnknownConsoles(t *testing.T) {
+	romDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(romDir, "gb"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	h := &previewHandler{&Options{RomDir: romDir, ConsoleMap: map[string]string{"gb": "gameboy"}}}
+	for _, console := range []string{"gb", "gameboy"} {
+		if !h.isConsole(console) {
+			t.Errorf("isConsole(%q) = false, want true", console)
+		}
+	}
+	// Paths as they arrive after unescaping, e.g. /%2e%2e/x.png is /../x.png.
+	for _, path := range []string{
+		"/../x.png", "/./x.png", `/..\gb/x.png`, "/nes/x.png",
+		// game is joined to the media directory.
+		`/gb/..\..\secret.png`, "/gb/...png", "/gb/.png",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.URL.Path = path
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s: status %d, want %d", path, rec.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestIsPathElem(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"Tetris", true},
+		{"Super Mario Bros. 3", true},
+		{"..hidden", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"../secret", false},
+		{`..\..\secret`, false},
+		{`C:\secret`, false},
+		{"/etc/passwd", false},
+	}
+	for _, tt := range tests {
+		if got := isPathElem(tt.s); got != tt.want {
+			t.Errorf("isPathElem(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// sourceStat identifies a version of a source file.
+type sourceStat struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// runState remembers which source files every output was generated from,
+// and with which renderVersion, so that later runs can skip outputs whose
+// sources did not change without ever opening them. It does not track
+// options: after changing them, the state file should be deleted.
+type runState struct {
+	path string
+
+	mu       sync.Mutex
+	Outputs  map[string][]sourceStat `json:"outputs"`
+	Versions map[string]int          `json:"versions"`
+}
+
+// loadState reads the state file at path. A missing file yields an empty
+// state.
+func loadState(path string) (*runState, error) {
+	s := &runState{path: path, Outputs: make(map[string][]sourceStat), Versions: make(map[string]int)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	if s.Outputs == nil {
+		s.Outputs = make(map[string][]sourceStat)
+	}
+	if s.Versions == nil {
+		s.Versions = make(map[string]int)
+	}
+	return s, nil
+}
+
+func statSource(path string) (sourceStat, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return sourceStat{}, err
+	}
+	return sourceStat{Path: path, Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+// upToDate reports whether target exists, was rendered by the current
+// renderVersion, and all of the sources it was generated from are
+// unchanged.
+func (s *runState) upToDate(target string) bool {
+	s.mu.Lock()
+	sources := s.Outputs[target]
+	version := s.Versions[target]
+	s.mu.Unlock()
+	if len(sources) == 0 || version < renderVersion || !fileExists(target) {
+		return false
+	}
+	for _, src := range sources {
+		cur, err := statSource(src.Path)
+		if err != nil || cur.Size != src.Size || !cur.ModTime.Equal(src.ModTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// record remembers the sources target was generated from. Outputs without
+// sources, like placeholders, are forgotten so that they get regenerated.
+func (s *runState) record(target string, sources []string) {
+	var stats []sourceStat
+	for _, src := range sources {
+		st, err := statSource(src)
+		if err != nil {
+			stats = nil
+			break
+		}
+		stats = append(stats, st)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(stats) == 0 {
+		delete(s.Outputs, target)
+		delete(s.Versions, target)
+	} else {
+		s.Outputs[target] = stats
+		s.Versions[target] = renderVersion
+	}
+}
+
+// save writes the state back to its file.
+func (s *runState) save() error {
+	s.mu.Lock()
+	data, err := json.MarshalIndent(s, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(cur[j-1]+1, prev[j]+1), prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// suggester finds the media files closest to the names of games without
+// artwork. Directory listings are read once.
+type suggester map[string][]string
+
+// mediaFiles returns the artwork files in dir.
+func (s suggester) mediaFiles(dir string) []string {
+	if files, ok := s[dir]; ok {
+		return files
+	}
+	var files []string
+	entries, _ := ioutil.ReadDir(dir)
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		for _, artExt := range artworkExts {
+			if !e.IsDir() && ext == artExt {
+				files = append(files, e.Name())
+				break
+			}
+		}
+	}
+	s[dir] = files
+	return files
+}
+
+// closest returns the artwork file in dir whose name is closest to game,
+// ignoring case, or "" if there are none.
+func (s suggester) closest(dir, game string) string {
+	best, bestDist := "", -1
+	game = strings.ToLower(game)
+	for _, f := range s.mediaFiles(dir) {
+		d := levenshtein(game, strings.ToLower(trimExt(f)))
+		if bestDist < 0 || d < bestDist {
+			best, bestDist = f, d
+		}
+	}
+	return best
+}
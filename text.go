@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"image"
+	"image/color"
+	"regexp"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+var (
+	titleTagRegexp = regexp.MustCompile(`\s*[\(\[][^\)\]]*[\)\]]`)
+
+	parsedFontOnce sync.Once
+	parsedFont     *opentype.Font
+	parsedFontErr  error
+)
+
+// cleanTitle strips tags like "(USA)" or "[!]" from a game name, leaving
+// something that is fit for display.
+func cleanTitle(game string) string {
+	title := titleTagRegexp.ReplaceAllString(game, "")
+	title = strings.TrimSpace(strings.ReplaceAll(title, "_", " "))
+	if len(title) == 0 {
+		return game
+	}
+	return title
+}
+
+func newFace(size float64) (font.Face, error) {
+	parsedFontOnce.Do(func() {
+		parsedFont, parsedFontErr = opentype.Parse(goregular.TTF)
+	})
+	if parsedFontErr != nil {
+		return nil, parsedFontErr
+	}
+	return opentype.NewFace(parsedFont, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+}
+
+// wrapText breaks s at word boundaries into lines that are at most maxW
+// pixels wide. Single words that are wider than maxW get a line of their own.
+func wrapText(face font.Face, s string, maxW int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(s) {
+		candidate := word
+		if len(line) > 0 {
+			candidate = line + " " + word
+		}
+		if len(line) > 0 && font.MeasureString(face, candidate).Ceil() > maxW {
+			lines = append(lines, line)
+			line = word
+		} else {
+			line = candidate
+		}
+	}
+	if len(line) > 0 {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// drawText draws s centered into r, wrapping it as needed. Anything that
+// does not fit is clipped.
+func drawText(dst draw.Image, r image.Rectangle, s string, size float64, c color.Color) error {
+	face, err := newFace(size)
+	if err != nil {
+		return err
+	}
+	defer face.Close()
+
+	lines := wrapText(face, s, r.Dx())
+	metrics := face.Metrics()
+	lineH := metrics.Height.Ceil()
+	y := r.Min.Y + (r.Dy()-len(lines)*lineH)/2 + metrics.Ascent.Ceil()
+
+	d := &font.Drawer{
+		Dst:  subImage(dst, r),
+		Src:  image.NewUniform(c),
+		Face: face,
+	}
+	for _, line := range lines {
+		w := d.MeasureString(line).Ceil()
+		d.Dot = fixed.P(r.Min.X+(r.Dx()-w)/2, y)
+		d.DrawString(line)
+		y += lineH
+	}
+	return nil
+}
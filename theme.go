@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// themeFlags are the flags a theme file may set, mapped to whether their
+// values are files, which are relative to the theme file. Everything else,
+// like where ROMs and artwork are, is up to the user.
+var themeFlags = map[string]bool{
+	"output_size":             false,
+	"output_aspect":           false,
+	"variant":                 false,
+	"layers":                  true,
+	"quality":                 false,
+	"adaptive_scaler":         false,
+	"upscale_threshold":       false,
+	"center_full":             false,
+	"center_full_max":         false,
+	"screen_anchor":           false,
+	"screen_margin":           false,
+	"fill_snap":               false,
+	"uniform_height":          false,
+	"uniform_height_consoles": false,
+	"safe_inset":              false,
+	"bg_color":                false,
+	"background":              true,
+	"mockup":                  true,
+	"mockup_screen":           false,
+	"tight":                   false,
+	"feather":                 false,
+	"reflection":              false,
+	"reflection_opacity":      false,
+	"vignette":                false,
+	"badge_corner":            false,
+	"flatten":                 false,
+	"palette_file":            true,
+	"dither":                  false,
+	"border_width":            false,
+	"border_color":            false,
+	"blend":                   false,
+	"border_around":           false,
+	"corner_radius":           false,
+	"aa":                      false,
+	"placeholder":             false,
+	"placeholder_art":         true,
+	"playlist_columns":        false,
+	"playlist_spacing":        false,
+	"hero_blur":               false,
+	"hero_darken":             false,
+	"wheel_height":            false,
+}
+
+// applyTheme sets the flags in the theme file path that weren't given on
+// the command line. A theme is a JSON object mapping the names of
+// themeFlags to strings, numbers, or booleans; "variant" takes a list of
+// variant specs. The values are checked like those given on the command
+// line.
+func applyTheme(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var theme map[string]interface{}
+	if err := json.Unmarshal(data, &theme); err != nil {
+		return err
+	}
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	var names []string
+	for name := range theme {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		isFile, ok := themeFlags[name]
+		if !ok {
+			return fmt.Errorf("%q can't be set by themes", name)
+		}
+		if given[name] {
+			continue
+		}
+		values := []interface{}{theme[name]}
+		if list, ok := theme[name].([]interface{}); ok && name == "variant" {
+			values = list
+		}
+		for _, v := range values {
+			s, err := themeValue(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			if isFile && len(s) > 0 && !filepath.IsAbs(s) {
+				s = filepath.Join(filepath.Dir(path), s)
+			}
+			if err := flag.Set(name, s); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// themeValue returns the JSON value v as a flag value.
+func themeValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("expected a string, number, or boolean, got %v", v)
+}
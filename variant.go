@@ -0,0 +1,190 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Variant is one kind of image that is generated for every game, e.g. a
+// box art image and a logo image.
+type Variant struct {
+	// Suffix is appended to the game name to form the output file name.
+	Suffix string
+	// MediaDir contains the artwork for this variant, one directory per
+	// console.
+	MediaDir string
+	// MediaMap overrides the media directory for individual consoles.
+	MediaMap map[string]string
+	// MediaTemplate, if set, replaces MediaDir. It is the path of the
+	// directory holding the artwork, with "{console}" standing for the
+	// console.
+	MediaTemplate string
+	// MediaKind is the kind of artwork, e.g. "wheel", that --scraper looks
+	// up for this variant.
+	MediaKind string
+	// Layout is the box the artwork is placed in.
+	Layout LayoutOpts
+	// Scaler, if set, is the name of the scaler in scalers used for this
+	// variant instead of the one picked by --quality.
+	Scaler string
+	// Fit is how the artwork is fit into the box: "contain" (keep the
+	// aspect ratio, the default), "cover" (fill the box, cropping the
+	// artwork), or "stretch".
+	Fit string
+	// Size, if set, is the size of the variant's images instead of the
+	// main image's.
+	Size canvasSize
+}
+
+// forVariant returns the options to generate the images of v with: opts
+// itself, or a copy with the variant's settings applied.
+func (opts *Options) forVariant(v *Variant) *Options {
+	if len(v.Scaler) == 0 && len(v.Fit) == 0 && v.Size.W == 0 {
+		return opts
+	}
+	o := *opts
+	if len(v.Scaler) > 0 {
+		o.Scaler = v.Scaler
+	}
+	if len(v.Fit) > 0 {
+		o.Fit = v.Fit
+	}
+	if v.Size.W > 0 {
+		o.CanvasW, o.CanvasH = v.Size.W, v.Size.H
+	}
+	return &o
+}
+
+// consoleMediaDir returns the directory holding the artwork for console. If
+// it is missing or empty, the first directory named after one of the
+// console's aliases that has any files is used instead.
+func (v *Variant) consoleMediaDir(console string, aliases consoleAliases) string {
+	if dir, ok := v.MediaMap[console]; ok {
+		return dir
+	}
+	dirFor := func(console string) string {
+		if len(v.MediaTemplate) > 0 {
+			return strings.ReplaceAll(v.MediaTemplate, "{console}", console)
+		}
+		return filepath.Join(v.MediaDir, console)
+	}
+	dir := dirFor(console)
+	if hasFiles(dir) {
+		return dir
+	}
+	for _, alias := range aliases[console] {
+		if d := dirFor(alias); hasFiles(d) {
+			return d
+		}
+	}
+	return dir
+}
+
+// variantsFlag collects the variants of repeated --variant flags.
+type variantsFlag []Variant
+
+func (f *variantsFlag) String() string {
+	var specs []string
+	for _, v := range *f {
+		specs = append(specs, fmt.Sprintf("suffix=%s,media_dir=%s,box=%s", v.Suffix, v.MediaDir, v.Layout))
+	}
+	return strings.Join(specs, " ")
+}
+
+func (f *variantsFlag) Set(spec string) error {
+	v, err := parseVariant(spec)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, v)
+	return nil
+}
+
+// parseVariant parses a variant spec like
+// "suffix=-logo,media_dir=logos,box=320x100+15+65,scaler=nearest", or with
+// "kind=wheel" instead of media_dir for --scraper. Settings
+// that are not given are taken from the main image; with a size but no box,
+// the default box is scaled to the size.
+func parseVariant(spec string) (Variant, error) {
+	v := Variant{Layout: defaultLayout}
+	hasBox := false
+	for _, part := range strings.Split(spec, ",") {
+		key, val, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return v, fmt.Errorf("Invalid variant setting %q", part)
+		}
+		switch key {
+		case "suffix":
+			v.Suffix = val
+		case "media_dir":
+			v.MediaDir = val
+		case "kind":
+			v.MediaKind = val
+		case "box":
+			box, err := parseBox(val)
+			if err != nil {
+				return v, err
+			}
+			v.Layout = box
+			hasBox = true
+		case "scaler":
+			if _, ok := scalers[val]; !ok {
+				return v, fmt.Errorf("Unknown scaler %q", val)
+			}
+			v.Scaler = val
+		case "fit":
+			switch val {
+			case "contain", "cover", "stretch":
+			default:
+				return v, fmt.Errorf("Unknown fit %q", val)
+			}
+			v.Fit = val
+		case "size":
+			w, h, err := parseSize(val)
+			if err != nil {
+				return v, err
+			}
+			v.Size = canvasSize{w, h}
+		default:
+			return v, fmt.Errorf("Unknown variant setting %q", key)
+		}
+	}
+	if len(v.Suffix) == 0 {
+		return v, errors.New("Variants need a suffix")
+	}
+	if v.Size.W > 0 && !hasBox {
+		v.Layout = defaultLayout.scaled(float64(v.Size.W)/screenW, float64(v.Size.H)/screenH)
+	}
+	return v, nil
+}
+
+// parseBox parses a box in X11 geometry notation, WxH+X+Y.
+func parseBox(s string) (LayoutOpts, error) {
+	var b LayoutOpts
+	if _, err := fmt.Sscanf(s, "%dx%d+%d+%d", &b.BoxW, &b.BoxH, &b.BoxX, &b.BoxY); err != nil {
+		return b, fmt.Errorf("Invalid box %q, expected WxH+X+Y", s)
+	}
+	if b.BoxW <= 0 || b.BoxH <= 0 {
+		return b, fmt.Errorf("Invalid box %q, width and height must be positive", s)
+	}
+	return b, nil
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import "testing"
+
+func TestForVariantKeepsUnsetFields(t *testing.T) {
+	opts := &Options{Fit: "cover", Scaler: "nearest", CanvasW: 640, CanvasH: 480}
+	tests := []struct {
+		name        string
+		v           Variant
+		fit, scaler string
+		w, h        int
+	}{
+		{"nothing set", Variant{}, "cover", "nearest", 640, 480},
+		{"size only", Variant{Size: canvasSize{320, 240}}, "cover", "nearest", 320, 240},
+		{"scaler only", Variant{Scaler: "bilinear"}, "cover", "bilinear", 640, 480},
+		{"fit only", Variant{Fit: "contain"}, "contain", "nearest", 640, 480},
+	}
+	for _, tt := range tests {
+		o := opts.forVariant(&tt.v)
+		if o.Fit != tt.fit || o.Scaler != tt.scaler || o.CanvasW != tt.w || o.CanvasH != tt.h {
+			t.Errorf("%s: got fit %q, scaler %q, %dx%d; want %q, %q, %dx%d",
+				tt.name, o.Fit, o.Scaler, o.CanvasW, o.CanvasH, tt.fit, tt.scaler, tt.w, tt.h)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// videoExts are the extensions of preview videos frames can be taken from.
+var videoExts = []string{".mp4", ".mkv", ".webm", ".avi"}
+
+// ffmpegBinary is the executable used to decode videos.
+const ffmpegBinary = "ffmpeg"
+
+var (
+	videoTimeRE  = regexp.MustCompile(`^((\d+:)?\d+:\d+(\.\d+)?|\d+(\.\d+)?s)$`)
+	videoIndexRE = regexp.MustCompile(`^\d+$`)
+)
+
+// videoFrame selects the frame taken from videos, either by time or by
+// frame number.
+type videoFrame struct {
+	Time  string
+	Index string
+}
+
+// parseVideoFrame parses a time like "5s" or "00:01:02.5", or a frame
+// number like "120".
+func parseVideoFrame(s string) (*videoFrame, error) {
+	switch {
+	case videoTimeRE.MatchString(s):
+		return &videoFrame{Time: s}, nil
+	case videoIndexRE.MatchString(s):
+		return &videoFrame{Index: s}, nil
+	}
+	return nil, fmt.Errorf("expected a time like 5s or 00:01:02.5, or a frame number")
+}
+
+// args returns the ffmpeg arguments extracting the frame from path as PNG
+// to stdout.
+func (f *videoFrame) args(path string) []string {
+	args := []string{"-v", "error"}
+	if len(f.Time) > 0 {
+		args = append(args, "-ss", f.Time, "-i", path)
+	} else {
+		args = append(args, "-i", path, "-vf", `select=eq(n\,`+f.Index+`)`)
+	}
+	return append(args, "-frames:v", "1", "-f", "image2pipe", "-vcodec", "png", "-")
+}
+
+// loadVideoFrame extracts the selected frame from a game's video in
+// mediaDir. It returns the frame and the video it was taken from.
+func loadVideoFrame(f *videoFrame, mediaDir, game string) (image.Image, string, error) {
+	for _, ext := range videoExts {
+		path := filepath.Join(mediaDir, game+ext)
+		if !fileExists(path) {
+			continue
+		}
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command(ffmpegBinary, f.args(path)...)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return nil, "", fmt.Errorf("Can't extract frame from %s: %s: %s", path, err, strings.TrimSpace(stderr.String()))
+		}
+		if stdout.Len() == 0 {
+			return nil, "", fmt.Errorf("Can't extract frame from %s: video is too short", path)
+		}
+		img, _, err := image.Decode(&stdout)
+		return img, path, err
+	}
+	return nil, "", errNoArtwork
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseVideoFrame(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    *videoFrame
+		wantErr bool
+	}{
+		{"5s", &videoFrame{Time: "5s"}, false},
+		{"2.5s", &videoFrame{Time: "2.5s"}, false},
+		{"00:01:02.5", &videoFrame{Time: "00:01:02.5"}, false},
+		{"01:02", &videoFrame{Time: "01:02"}, false},
+		{"120", &videoFrame{Index: "120"}, false},
+		{"0", &videoFrame{Index: "0"}, false},
+		{"", nil, true},
+		{"-5s", nil, true},
+		{"5 s", nil, true},
+		{"frame 3", nil, true},
+		// Whatever is accepted ends up in ffmpeg's arguments.
+		{"1;rm -rf /", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseVideoFrame(tt.s)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseVideoFrame(%q) = %+v, %v; want %+v, error %v", tt.s, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestVideoFrameArgs(t *testing.T) {
+	tests := []struct {
+		f    videoFrame
+		want []string
+	}{
+		{videoFrame{Time: "5s"}, []string{"-v", "error", "-ss", "5s", "-i", "a.mp4", "-frames:v", "1", "-f", "image2pipe", "-vcodec", "png", "-"}},
+		{videoFrame{Index: "120"}, []string{"-v", "error", "-i", "a.mp4", "-vf", `select=eq(n\,120)`, "-frames:v", "1", "-f", "image2pipe", "-vcodec", "png", "-"}},
+	}
+	for _, tt := range tests {
+		if got := tt.f.args("a.mp4"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v.args = %q, want %q", tt.f, got, tt.want)
+		}
+	}
+}
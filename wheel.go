@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2023 Andreas Signer <asigner@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU General Public License as published by the
+ * Free Software Foundation, either version 3 of the License, or (at your
+ * option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+ * or FITNESS FOR A PARTICULAR PURPOSE. See the GNU General Public License
+ * for more details.
+ *
+ * You should have received a copy of the GNU General Public License along
+ * with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"path/filepath"
+
+	"golang.org/x/image/draw"
+)
+
+// wheelKind is the kind of artwork scrapers store game logos as.
+const wheelKind = "wheel"
+
+// wheelDir returns the directory the wheel logos for console are written
+// to.
+func wheelDir(opts *Options, console string) string {
+	root := opts.RomDir
+	if len(opts.OutputRoot) > 0 {
+		root = opts.OutputRoot
+	}
+	return filepath.Join(root, console, opts.WheelDir)
+}
+
+// genWheel writes a game's logo from mediaDir to dir, stripped of its
+// transparent margins and scaled to WheelHeight pixels high, or less if it
+// would be wider than the canvas. It returns the file written, or "" if it
+// was skipped.
+func genWheel(opts *Options, mediaDir, dir, console, game string) (string, error) {
+	targetName := filepath.Join(dir, outputName(opts, console, game, &Variant{})+opts.Format.Ext)
+	if opts.SkipExisting && fileExists(targetName) {
+		return "", nil
+	}
+	// Logos are neither in the artwork database nor in the manifest.
+	o := *opts
+	o.ArtDB = nil
+	o.ArtManifest = nil
+	logo, src, err := findGameArtwork(&o, mediaDir, console, game)
+	if err != nil {
+		return "", err
+	}
+	b := logo.Bounds()
+	img := opts.newImage(b)
+	draw.Copy(img, b.Min, logo, b, draw.Src, nil)
+	trimmed := trimTransparent(img)
+	b = trimmed.Bounds()
+	w, h, _, _ := opts.fitLayout(b.Dx(), b.Dy(), LayoutOpts{BoxW: opts.CanvasW, BoxH: opts.WheelHeight})
+	scaled := scaleImage(opts, opts.shrinkSource(trimmed, w, h), w, h, opts.scalerFor(b.Dx(), b.Dy(), w, h))
+
+	out := finishImage(opts, scaled)
+	if err := opts.writeImage(targetName, out, opts.imageEncoder([]string{src})); err != nil {
+		return "", err
+	}
+	if opts.PostCmd != nil {
+		if err := runPostCmd(opts.PostCmd, targetName); err != nil {
+			logger.Printf("Post-processing %s failed: %s\n", targetName, err)
+		}
+	}
+	return targetName, nil
+}